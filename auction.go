@@ -0,0 +1,214 @@
+package orderbook
+
+import "time"
+
+// Phase is the trading phase of a book.
+type Phase int
+
+const (
+	// Continuous books match orders as they arrive.
+	Continuous Phase = iota
+	// Auction books collect orders without matching them,
+	// until they are uncrossed at a single price.
+	Auction
+)
+
+// Phase returns the trading phase of the book.
+func (b *Book) Phase() Phase {
+	return b.phase
+}
+
+// StartAuction stops continuous matching and starts a call auction. During an
+// auction orders rest in the book even if they cross, and only resting limit
+// orders that are not post-only are accepted, along with stop orders, which
+// are not triggered until the auction ends. Uncross ends the auction.
+//
+// The reference price breaks ties between clearing prices, such as the
+// previous close in an opening auction. If it is zero the last trade price is
+// the reference.
+func (b *Book) StartAuction(reference Price) error {
+	if b.phase == Auction {
+		return &OrderError{Op: "start auction", Err: ErrAuction}
+	}
+	now := b.now()
+	if err := b.journal.startAuction(reference, now); err != nil {
+		return &OrderError{Op: "start auction", Err: err}
+	}
+	b.startAuction(reference, now)
+	return nil
+}
+
+// startAuction switches the book to the auction phase at now.
+func (b *Book) startAuction(reference Price, now time.Time) {
+	b.at = now
+	b.phase = Auction
+	b.reference = reference
+}
+
+// Uncross ends a call auction. Every order that crosses the clearing price
+// trades at that price, in price then time priority, and the book returns to
+// continuous trading. Should self trade prevention cancel orders the clearing
+// price counted on, leaving the book crossed, the orders still crossing trade
+// at the clearing price of what is left, until the book no longer crosses.
+//
+// Each trade is reported as a pair of fills, the earlier order's first. Auction
+// fills have no Liquidity, neither order took liquidity from the other. Expired
+// reports for orders that expired before the uncross come first, and the
+// executions of any stop orders the auction trades trigger come last.
+func (b *Book) Uncross() ([]Execution, error) {
+	if b.phase != Auction {
+		return nil, &OrderError{Op: "uncross", Err: ErrNoAuction}
+	}
+	now := b.now()
+	if err := b.journal.uncross(now); err != nil {
+		return nil, &OrderError{Op: "uncross", Err: err}
+	}
+	return b.uncross(now), nil
+}
+
+// uncross trades the crossed orders of an auction at the clearing price.
+func (b *Book) uncross(now time.Time) []Execution {
+	b.at = now
+	matches := b.expire(now)
+	for price, _ := b.clearing(); price != 0; price, _ = b.clearing() {
+		matches = append(matches, b.cross(price, now)...)
+	}
+
+	b.phase = Continuous
+	b.reference = 0
+	return stamp(append(matches, b.trigger(now)...), now)
+}
+
+// cross trades the orders that cross price at price.
+func (b *Book) cross(price Price, now time.Time) []Execution {
+	var matches []Execution
+	for b.bestBid != nil && b.bestAsk != nil && b.bestBid.price >= price && b.bestAsk.price <= price {
+		// The order that arrived later trades with the earlier one.
+		lim, tlim := b.bestBid, b.bestAsk
+		if lim.orders.first.time.After(tlim.orders.first.time) {
+			lim, tlim = tlim, lim
+		}
+		m, t := lim.orders.first, tlim.orders.first
+
+		if b.selfTrade(t, m) {
+			matches = append(matches, b.preventSelfTrade(t, tlim, m, lim)...)
+		} else {
+			qty := t.size
+			if m.size < qty {
+				qty = m.size
+			}
+			b.trade(t.side, price, qty, m.id, t.id)
+			b.fill(m, lim, qty, now)
+			b.fill(t, tlim, qty, now)
+			matches = append(matches, Execution{
+				OrderID:           m.id,
+				Side:              m.side,
+				FilledQuantity:    qty,
+				RemainingQuantity: m.size + m.hidden,
+				HiddenQuantity:    m.hidden,
+				Price:             price,
+				TradeID:           b.trades,
+				Counterparty:      t.id,
+			}, Execution{
+				OrderID:           t.id,
+				Side:              t.side,
+				FilledQuantity:    qty,
+				RemainingQuantity: t.size + t.hidden,
+				HiddenQuantity:    t.hidden,
+				Price:             price,
+				TradeID:           b.trades,
+				Counterparty:      m.id,
+			})
+		}
+
+		if lim.orders.Empty() {
+			b.deleteLimit(m.side, lim)
+		}
+		if tlim.orders.Empty() {
+			b.deleteLimit(t.side, tlim)
+		}
+	}
+	return matches
+}
+
+// ClearingPrice returns the price the book would uncross at and the quantity
+// that would trade, or zeros if the book is not crossed.
+//
+// The clearing price is the limit price in the book that trades the most.
+// Between prices that trade the same, it is the one that leaves the least
+// quantity unfilled at that price on either side, then the one nearest the
+// auction's reference price, then the lower one.
+func (b *Book) ClearingPrice() (Price, Quantity) {
+	return b.clearing()
+}
+
+// clearing returns the clearing price of the book and the quantity traded at it.
+func (b *Book) clearing() (Price, Quantity) {
+	if b.bestBid == nil || b.bestAsk == nil || b.bestBid.price < b.bestAsk.price {
+		return 0, 0
+	}
+
+	// The levels that can trade, lowest price first on both sides.
+	var bids, asks []*limitPrice
+	for lim := b.bestBid; lim != nil && lim.price >= b.bestAsk.price; lim = lim.lower() {
+		bids = append(bids, lim)
+	}
+	for i, j := 0, len(bids)-1; i < j; i, j = i+1, j-1 {
+		bids[i], bids[j] = bids[j], bids[i]
+	}
+	for lim := b.bestAsk; lim != nil && lim.price <= b.bestBid.price; lim = lim.higher() {
+		asks = append(asks, lim)
+	}
+
+	// Walk the candidate prices upwards, demand falls as the bids below
+	// them drop out and supply rises as the asks at or below them come in.
+	var demand, supply Quantity
+	for _, lim := range bids {
+		demand += lim.orders.volume + lim.orders.hidden
+	}
+	var best struct {
+		price             Price
+		volume, imbalance Quantity
+	}
+	reference := b.reference
+	if reference == 0 {
+		reference = b.last
+	}
+	for i, j := 0, 0; i < len(bids) || j < len(asks); {
+		var price Price
+		if j == len(asks) || (i < len(bids) && bids[i].price < asks[j].price) {
+			price = bids[i].price
+		} else {
+			price = asks[j].price
+		}
+		for ; j < len(asks) && asks[j].price <= price; j++ {
+			supply += asks[j].orders.volume + asks[j].orders.hidden
+		}
+
+		traded, imbalance := demand, supply-demand
+		if supply < demand {
+			traded, imbalance = supply, demand-supply
+		}
+		better := traded > best.volume
+		if traded == best.volume {
+			better = imbalance < best.imbalance || (imbalance == best.imbalance &&
+				distance(price, reference) < distance(best.price, reference))
+		}
+		if best.price == 0 || better {
+			best.price, best.volume, best.imbalance = price, traded, imbalance
+		}
+
+		for ; i < len(bids) && bids[i].price <= price; i++ {
+			demand -= bids[i].orders.volume + bids[i].orders.hidden
+		}
+	}
+	return best.price, best.volume
+}
+
+// distance returns how far apart two prices are.
+func distance(a, b Price) Price {
+	if a < b {
+		return b - a
+	}
+	return a - b
+}
@@ -1,45 +1,262 @@
 package orderbook
 
-import "errors"
+import "time"
 
 // Book is a limit-price orderbook for a particular instrument,
-// that matches buys and sells in continuous time.
+// that matches buys and sells in continuous time, or in call auctions.
 type Book struct {
 	bidTree  *limitPriceTree
 	askTree  *limitPriceTree
 	bestBid  *limitPrice
 	bestAsk  *limitPrice
 	orderMap map[OrderID]*order
-	bidMap   map[uint]*limitPrice
-	askMap   map[uint]*limitPrice
+	owners   map[string]map[OrderID]*order
+	bidMap   map[Price]*limitPrice
+	askMap   map[Price]*limitPrice
+	ids      IDGenerator
+	trades   uint64
+	last     Price
+
+	// Stop orders waiting to be triggered.
+	stopMap    map[OrderID]*order
+	buyStops   *stops
+	sellStops  *stops
+	buyTrails  *trailers
+	sellTrails *trailers
+	fired      []firing
+
+	seq       uint64
+	listeners []Listener
+
+	journal    *Journal
+	instrument Instrument
+	stp        SelfTradePrevention
+
+	clock      Clock
+	sessionEnd func(time.Time) time.Time
+	expiries   expiries
+	at         time.Time // time of the command being applied.
+
+	phase     Phase
+	reference Price // breaks ties between clearing prices.
+}
+
+// Config is the configuration of an order book.
+type Config struct {
+	// IDs generates the ids of new orders.
+	// Defaults to a Sequence starting at 1.
+	IDs IDGenerator
+
+	// Journal, if set, records every command before it is applied to the book.
+	Journal *Journal
+
+	// Instrument is the instrument the book trades, orders that break its
+	// rules are refused.
+	Instrument Instrument
+
+	// SelfTrade is what the book does when an incoming order would trade
+	// with a resting order of the same owner.
+	SelfTrade SelfTradePrevention
+
+	// Clock is the book's source of time. Defaults to the SystemClock.
+	Clock Clock
+
+	// SessionEnd returns the end of the trading session a day order
+	// submitted at a given time expires at. Defaults to the following
+	// midnight in the time's location.
+	SessionEnd func(time.Time) time.Time
 }
 
-// Init initializes a new order book.
+// Init initializes a new order book with the default configuration.
 func Init() *Book {
+	return New(Config{})
+}
+
+// New initializes a new order book with the given configuration.
+func New(cfg Config) *Book {
+	if cfg.IDs == nil {
+		cfg.IDs = NewSequence(1)
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = SystemClock{}
+	}
+	if cfg.SessionEnd == nil {
+		cfg.SessionEnd = endOfDay
+	}
 	return &Book{
-		bidTree:  &limitPriceTree{},
-		askTree:  &limitPriceTree{},
-		orderMap: make(map[OrderID]*order),
-		bidMap:   make(map[uint]*limitPrice),
-		askMap:   make(map[uint]*limitPrice),
+		bidTree:    &limitPriceTree{},
+		askTree:    &limitPriceTree{},
+		orderMap:   make(map[OrderID]*order),
+		owners:     make(map[string]map[OrderID]*order),
+		bidMap:     make(map[Price]*limitPrice),
+		askMap:     make(map[Price]*limitPrice),
+		stopMap:    make(map[OrderID]*order),
+		buyStops:   newStops(Bid),
+		sellStops:  newStops(Ask),
+		buyTrails:  &trailers{side: Bid},
+		sellTrails: &trailers{side: Ask},
+		ids:        cfg.IDs,
+		journal:    cfg.Journal,
+		instrument: cfg.Instrument,
+		stp:        cfg.SelfTrade,
+		clock:      cfg.Clock,
+		sessionEnd: cfg.SessionEnd,
 	}
 }
 
-// Submit submits a single order to the order book. The order must have a
+// Submit submits a single limit order to the order book. The order must have a
 // specified Side, either Buy or Sell, a nonzero price and nonzero size.
 //
 // The return values are:
 // * The order id for this order created during the matching process.
-// * A list a order executions that, if order matching was possible, will include the execution details
-//   of the orders that are matched, including the originally submitted order.
+// * A list a order executions that, if order matching was possible, will include a pair of fills
+//   for every trade, one for the resting order and one for the originally submitted order.
 // * An optional error.
-func (b *Book) Submit(side Side, price uint, size uint) (OrderID, []Execution, error) {
-	var (
-		matchedQty uint
-		matches    []Execution
-	)
-	if price == 0 || size == 0 {
-		return 0, matches, errors.New("price/size cannot be zero")
+func (b *Book) Submit(side Side, price Price, size Quantity) (OrderID, []Execution, error) {
+	return b.SubmitOrder(Order{Side: side, Type: Limit, Price: price, Size: size})
+}
+
+// SubmitOrder submits an order of any type to the order book. Limit orders
+// must have a nonzero price, market orders ignore the price. All orders must
+// have a nonzero size. An order may carry its own id, as long as no other
+// live order is using it.
+//
+// The return values are the same as for Submit. Market orders and immediate or
+// cancel orders never rest in the book, so whatever part of them could not be
+// filled is reported as a Cancelled execution. A fill or kill order that cannot
+// be filled entirely is cancelled whole, leaving the book untouched.
+//
+// Stop and stop limit orders are held outside the book until triggered, and
+// the executions of any stop orders an order triggers follow its own. Expired
+// reports for orders that expired before the order arrived come first.
+func (b *Book) SubmitOrder(o Order) (OrderID, []Execution, error) {
+	var matches []Execution
+	now := b.now()
+	if err := b.validate(o, now); err != nil {
+		return 0, matches, &OrderError{Op: "submit", ID: o.ID, Order: o, Err: err}
+	}
+
+	newOrderID, err := b.newID(o.ID)
+	if err != nil {
+		return 0, matches, &OrderError{Op: "submit", ID: o.ID, Order: o, Err: err}
+	}
+	expires := b.expiry(o, now)
+	if err := b.journal.submit(o, newOrderID, now, expires); err != nil {
+		return 0, matches, &OrderError{Op: "submit", ID: o.ID, Order: o, Err: err}
+	}
+	return newOrderID, b.submit(o, newOrderID, now, expires), nil
+}
+
+// validate checks an order before it is submitted at now.
+func (b *Book) validate(o Order, now time.Time) error {
+	switch o.Type {
+	case Limit, StopLimit:
+		if o.Price == 0 {
+			return ErrInvalidPrice
+		}
+		if err := b.instrument.checkPrice(o.Price); err != nil {
+			return err
+		}
+	case Market, Stop:
+	default:
+		return ErrInvalidOrderType
+	}
+	if o.Trailing != (Trailing{}) {
+		t := o.Trailing
+		if (o.Type != Stop && o.Type != StopLimit) || o.StopPrice != 0 ||
+			(t.Offset != 0) == (t.BasisPoints != 0) || b.last == 0 {
+			return ErrInvalidTrailingStop
+		}
+		if t.Offset%b.instrument.tick() != 0 {
+			return ErrOffTick
+		}
+		// The stop must start at a price, away from the last trade.
+		stop, ok := b.trailingStop(&order{side: o.Side, ref: b.last, stop: &o})
+		if !ok || stop == b.last {
+			return ErrInvalidTrailingStop
+		}
+		if err := b.instrument.checkPrice(stop); err != nil {
+			return err
+		}
+	} else if o.Type == Stop || o.Type == StopLimit {
+		if o.StopPrice == 0 {
+			return ErrInvalidStopPrice
+		}
+		if err := b.instrument.checkPrice(o.StopPrice); err != nil {
+			return err
+		}
+	} else if o.StopPrice != 0 {
+		return ErrInvalidStopPrice
+	}
+	if o.Size == 0 {
+		return ErrInvalidSize
+	}
+	if err := b.instrument.checkSize(o.Size); err != nil {
+		return err
+	}
+	if o.TimeInForce < GoodTillCancel || o.TimeInForce > Day {
+		return ErrInvalidTimeInForce
+	}
+	if o.TimeInForce == GoodTillDate {
+		if !o.ExpireTime.After(now) {
+			return ErrInvalidExpireTime
+		}
+	} else if !o.ExpireTime.IsZero() {
+		return ErrInvalidExpireTime
+	}
+	if o.PostOnly != Taker && (o.Type != Limit || !o.TimeInForce.rests()) {
+		return ErrInvalidPostOnly
+	}
+	if o.DisplaySize != 0 {
+		if o.Type != Limit || !o.TimeInForce.rests() {
+			return ErrInvalidDisplaySize
+		}
+		if err := b.instrument.checkSize(o.DisplaySize); err != nil {
+			return err
+		}
+	}
+	if b.phase == Auction {
+		// Only orders that wait for the uncross make sense in an auction.
+		if o.Type == Market || (o.Type == Limit && (!o.TimeInForce.rests() || o.PostOnly != Taker)) {
+			return ErrAuction
+		}
+	}
+	return nil
+}
+
+// submit applies a validated order that expires at expires to the book, after
+// expiring the orders due by now, followed by any stop orders it triggers.
+func (b *Book) submit(o Order, newOrderID OrderID, now, expires time.Time) []Execution {
+	b.at = now
+	matches := b.expire(now)
+	matches = append(matches, b.place(o, newOrderID, now, expires)...)
+	return stamp(append(matches, b.trigger(now)...), now)
+}
+
+// place applies a single order to the book, one that expires at expires,
+// or never if it is the zero time.
+func (b *Book) place(o Order, newOrderID OrderID, now, expires time.Time) []Execution {
+	var matches []Execution
+
+	if o.Type == Stop || o.Type == StopLimit {
+		s := &order{
+			id:    newOrderID,
+			side:  o.Side,
+			price: o.StopPrice,
+			size:  o.Size,
+			time:  now,
+			owner: o.Owner,
+			stop:  &o,
+
+			expires: expires,
+		}
+		if o.Trailing != (Trailing{}) {
+			// validate made sure the stop has a price.
+			s.ref = b.last
+			s.price, _ = b.trailingStop(s)
+		}
+		b.hold(s)
+		return matches
 	}
 
 	// General methodology:
@@ -49,227 +266,607 @@ func (b *Book) Submit(side Side, price uint, size uint) (OrderID, []Execution, e
 	// report order executions
 	// handle inserting into the book if we cant fill the entire order.
 
-	newOrderID := genID()
+	// Post-only orders must not take liquidity, check them against the
+	// top of the book before matching.
+	if o.PostOnly != Taker {
+		if best := b.best(!o.Side); best != nil && crosses(o.Side, o.Price, best.price) {
+			price, ok := b.slide(o.Side, best.price)
+			if o.PostOnly == PostOnlyReject || !ok {
+				matches = append(matches, Execution{OrderID: newOrderID, Type: Rejected, Side: o.Side})
+				return matches
+			}
+			o.Price = price
+			matches = append(matches, Execution{OrderID: newOrderID,
+				Type:              Repriced,
+				Side:              o.Side,
+				RemainingQuantity: o.Size,
+				Price:             price})
+		}
+	}
 
-	if side == Bid {
-		// Looking to buy, match aginst existing asks.
-		matchedQty, matches = b.matchBid(price, size)
-	} else {
-		// Looking to sell, match against existing bids.
-		matchedQty, matches = b.matchAsk(price, size)
+	t := &order{
+		id:    newOrderID,
+		side:  o.Side,
+		price: o.Price,
+		size:  o.Size,
+		time:  now,
+		owner: o.Owner,
+
+		display:  o.DisplaySize,
+		expires:  expires,
+		postOnly: o.PostOnly,
 	}
+	limit, maxLevels := b.bounds(o)
 
-	// Report the fact that the submitted order
-	// has been at least partially matched.
-	if matchedQty != 0 {
+	// Make sure a fill or kill order can be filled entirely before touching the book.
+	if o.TimeInForce == FillOrKill && b.liquidity(t, limit, maxLevels) < o.Size {
 		matches = append(matches, Execution{OrderID: newOrderID,
-			FilledQuantity:    matchedQty,
-			RemainingQuantity: size - matchedQty})
+			Type:              Cancelled,
+			Side:              o.Side,
+			CancelledQuantity: o.Size})
+		return matches
 	}
 
-	// Add new order to the book if the new order wasn't completely filled.
-	if matchedQty != size {
-		o := &order{
-			id:    newOrderID,
-			price: price,
-			size:  size - matchedQty,
-		}
-		b.orderMap[newOrderID] = o
-
-		if side == Bid {
-			// Check if the price limit already exists.
-			lim, ok := b.bidMap[price]
-			if !ok {
-				// Doesn't exist, add new limit/order to tree.
-				lim = b.bidTree.addLimit(price, o)
-			} else {
-				// Exists, just add the order to it.
-				lim.orders.add(o)
-			}
-			// Adjust best bid if needed.
-			if b.bestBid == nil || price > b.bestBid.price {
-				b.bestBid = lim
-			}
+	if b.phase == Continuous {
+		matches = append(matches, b.match(t, limit, maxLevels)...)
+	}
+
+	if t.size != 0 {
+		if o.Type == Market || !o.TimeInForce.rests() {
+			// Order can't rest, cancel whatever is left.
+			matches = append(matches, Execution{OrderID: newOrderID,
+				Type:              Cancelled,
+				Side:              o.Side,
+				CancelledQuantity: t.size})
 		} else {
-			// Check if the price limit already exists.
-			lim, ok := b.askMap[price]
-			if !ok {
-				// Doesn't exist, add new limit/order to tree.
-				lim = b.askTree.addLimit(price, o)
-			} else {
-				// Exists, just add the order to it.
-				lim.orders.add(o)
-			}
-			// Adjust best bid if needed.
-			if b.bestAsk == nil || price > b.bestAsk.price {
-				b.bestAsk = lim
-			}
+			// Add new order to the book if the new order wasn't completely filled.
+			b.rest(t)
+		}
+	}
+
+	return matches
+}
+
+// now returns the current time on the book's clock.
+func (b *Book) now() time.Time {
+	return b.clock.Now()
+}
+
+// newID returns the id for a new order, either the one supplied by the caller
+// or the next one from the book's generator that no live order is using.
+func (b *Book) newID(id OrderID) (OrderID, error) {
+	if id != 0 {
+		if b.live(id) {
+			return 0, ErrDuplicateOrderID
 		}
+		return id, nil
 	}
+	for {
+		id = b.ids.NextID()
+		if !b.live(id) {
+			return id, nil
+		}
+	}
+}
 
-	return newOrderID, matches, nil
+// live reports whether an order id belongs to a resting or a stop order.
+func (b *Book) live(id OrderID) bool {
+	if _, ok := b.orderMap[id]; ok {
+		return true
+	}
+	_, ok := b.stopMap[id]
+	return ok
 }
 
-func (b *Book) matchBid(bidPrice, bidSize uint) (uint, []Execution) {
+// bounds returns the worst price an order may trade at and the number of
+// price levels it may take liquidity from, zero meaning no limit.
+func (b *Book) bounds(o Order) (Price, int) {
+	if o.Type != Market {
+		return o.Price, 0
+	}
+	p := o.Protection
+	best := b.best(!o.Side)
+	slippage := Price(p.MaxSlippage) * b.instrument.tick()
+	if o.Side == Bid {
+		if p.MaxSlippage == 0 || best == nil {
+			return ^Price(0), p.MaxLevels
+		}
+		return best.price + slippage, p.MaxLevels
+	}
+	if p.MaxSlippage == 0 || best == nil || slippage >= best.price {
+		return 0, p.MaxLevels
+	}
+	return best.price - slippage, p.MaxLevels
+}
+
+// match takes liquidity from the opposite side of the book for an incoming
+// order, at prices no worse than limit, reducing its size as it fills. If
+// maxLevels is nonzero at most that many price levels are matched against.
+//
+// Every trade is reported as a pair of fills, the resting order's first,
+// at the resting order's price.
+func (b *Book) match(t *order, limit Price, maxLevels int) []Execution {
 
 	// Matching methodology:
 	//
-	// find best ask price.
-	// iterate through existing ask orders at that price.
-	// if an ask order is filled, remove from the
+	// find best opposite price.
+	// iterate through existing orders at that price.
+	// if a resting order is filled, remove from the
 	// order list and remove from the order map.
-	// keep iterating until the bid is filled.
-	// if the buy cannot be filled entirely at this price, advance to the next-best ask price.
-	// if this happens, delete the old best ask limit from the ask tree
-	// and delete the ask limit from the price map
-	// repeat this process until the next ask limit is higher than the bidPrice,
-	// there are no more ask limits, or the bid is filled.
+	// keep iterating until the incoming order is filled.
+	// if it cannot be filled entirely at this price, advance to the next-best price.
+	// if this happens, delete the old best limit from the tree
+	// and delete the limit from the price map
+	// repeat this process until the next limit is worse than the limit price,
+	// there are no more limits, or the order is filled.
 
 	matches := []Execution{}
+	side := t.side
 
-	remaining := bidSize
-	for remaining != 0 {
-		if b.bestAsk == nil || bidPrice < b.bestAsk.price {
+	for levels := 0; t.size != 0; levels++ {
+		lim := b.best(!side)
+		if lim == nil || !crosses(side, limit, lim.price) {
 			// Cant match, exit.
 			break
 		}
-
-		potentialmatch := b.bestAsk.orders.first
-		if potentialmatch == nil {
-			// No orders left at this level. advance to the next limit price.
-			next := b.bestAsk.higher()
-			b.askTree.removeLimit(b.bestAsk.price)
-			delete(b.askMap, b.bestAsk.price)
-			b.bestAsk = next
-			continue
+		if maxLevels != 0 && levels == maxLevels {
+			// Swept as far as allowed.
+			break
 		}
 
-		if potentialmatch.size <= remaining {
-			// Fill existing order and remove from order map.
-			remaining -= potentialmatch.size
-			delete(b.orderMap, potentialmatch.id)
-			b.bestAsk.orders.remove(0)
-			matches = append(matches, Execution{
-				OrderID:           potentialmatch.id,
-				FilledQuantity:    potentialmatch.size,
-				RemainingQuantity: 0,
-			})
-		} else {
-			// Partial fill the existing ask order and move on.
+		for t.size != 0 && lim.orders.first != nil {
+			potentialmatch := lim.orders.first
+			if b.selfTrade(t, potentialmatch) {
+				matches = append(matches, b.preventSelfTrade(t, nil, potentialmatch, lim)...)
+				continue
+			}
+
+			qty := t.size
+			if potentialmatch.size < qty {
+				qty = potentialmatch.size
+			}
+			t.size -= qty
+			b.trade(side, lim.price, qty, potentialmatch.id, t.id)
+			b.fill(potentialmatch, lim, qty, t.time)
 			matches = append(matches, Execution{
 				OrderID:           potentialmatch.id,
-				FilledQuantity:    remaining,
-				RemainingQuantity: potentialmatch.size - remaining,
+				Side:              potentialmatch.side,
+				FilledQuantity:    qty,
+				RemainingQuantity: potentialmatch.size + potentialmatch.hidden,
+				HiddenQuantity:    potentialmatch.hidden,
+				Price:             lim.price,
+				TradeID:           b.trades,
+				Counterparty:      t.id,
+				Liquidity:         LiquidityAdded,
+			}, Execution{
+				OrderID:           t.id,
+				Side:              side,
+				FilledQuantity:    qty,
+				RemainingQuantity: t.size,
+				Price:             lim.price,
+				TradeID:           b.trades,
+				Counterparty:      potentialmatch.id,
+				Liquidity:         LiquidityRemoved,
 			})
-			potentialmatch.size -= remaining
-			remaining = 0
+		}
+
+		if lim.orders.Empty() {
+			// No orders left at this level, the next best takes its place.
+			b.deleteLimit(!side, lim)
 		}
 	}
 
-	return bidSize - remaining, matches
+	return matches
 }
 
-func (b *Book) matchAsk(askPrice, askSize uint) (uint, []Execution) {
+// trade records a trade of qty at price between the resting order maker and
+// the order taker on side.
+func (b *Book) trade(side Side, price Price, qty Quantity, maker, taker OrderID) {
+	b.trades++
+	b.last = price
+	b.follow(price)
+	b.fire(price)
+	b.emit(Event{
+		Type:    Trade,
+		Side:    side,
+		Price:   price,
+		Size:    qty,
+		TradeID: b.trades,
+		Maker:   maker,
+		Taker:   taker,
+	})
+}
 
-	matches := []Execution{}
-	remaining := askSize
+// fill takes qty, at most its shown size, off the resting order o at the front
+// of lim's queue. A filled order leaves the book, unless it has a reserve to
+// refill it from, as of now.
+func (b *Book) fill(o *order, lim *limitPrice, qty Quantity, now time.Time) {
+	if qty < o.size {
+		// Partial fills leave the existing order in place.
+		lim.orders.volume -= qty
+		o.size -= qty
+		b.emitOrder(OrderReduced, o, lim)
+		return
+	}
+	lim.orders.remove(0)
+	if o.hidden == 0 {
+		b.forget(o)
+	}
+	o.size = 0
+	b.emitOrder(OrderDeleted, o, lim)
+	if o.hidden != 0 {
+		b.replenish(o, lim, now)
+	}
+}
 
-	for remaining != 0 {
-		if b.bestBid == nil || askPrice > b.bestBid.price {
-			// Cant match, exit.
+// liquidity returns how much of an incoming order could be filled right now,
+// under the same constraints as match, without changing the book.
+func (b *Book) liquidity(t *order, limit Price, maxLevels int) Quantity {
+	var filled Quantity
+	remaining := t.size
+	lim := b.best(!t.side)
+	for levels := 0; lim != nil && remaining != 0; levels++ {
+		if !crosses(t.side, limit, lim.price) || (maxLevels != 0 && levels == maxLevels) {
 			break
 		}
+		if !b.preventsSelfTrade(t) {
+			// Only the level's total matters.
+			qty := lim.orders.volume + lim.orders.hidden
+			if qty > remaining {
+				qty = remaining
+			}
+			filled += qty
+			remaining -= qty
+		} else {
+			// Walk the queue as match would, an iceberg's clip going back
+			// in line behind the level each time it is refilled.
+			queue := []clip{}
+			for o := lim.orders.first; o != nil; o = o.next {
+				queue = append(queue, clip{o, o.size, o.hidden})
+			}
+			for len(queue) != 0 && remaining != 0 {
+				c := queue[0]
+				queue = queue[1:]
+				if !b.selfTrade(t, c.o) {
+					qty := c.size
+					if qty > remaining {
+						qty = remaining
+					}
+					filled += qty
+					remaining -= qty
+					if qty == c.size && c.hidden != 0 {
+						refill := c.o.display
+						if refill > c.hidden {
+							refill = c.hidden
+						}
+						queue = append(queue, clip{c.o, refill, c.hidden - refill})
+					}
+					continue
+				}
+				switch b.stp {
+				case CancelNewest, CancelBoth:
+					return filled
+				case DecrementAndCancel:
+					qty := c.size + c.hidden
+					if qty > remaining {
+						qty = remaining
+					}
+					remaining -= qty
+				}
+			}
+		}
+		lim = next(!t.side, lim)
+	}
+	return filled
+}
 
-		potentialmatch := b.bestBid.orders.first
-		if potentialmatch == nil {
-			// No orders left at this price. advance to the next limit price.
-			next := b.bestBid.lower()
-			b.bidTree.removeLimit(b.bestBid.price)
-			delete(b.bidMap, b.bestBid.price)
-			b.bestBid = next
-			continue
+// clip is the shown size of a resting order, and the reserve behind it,
+// as liquidity sees them.
+type clip struct {
+	o            *order
+	size, hidden Quantity
+}
+
+// crosses reports whether an order on the given side with the given
+// limit can trade against the opposite side at price.
+func crosses(side Side, limit, price Price) bool {
+	if side == Bid {
+		return limit >= price
+	}
+	return limit <= price
+}
+
+// best returns the best price limit on the given side of the book.
+func (b *Book) best(side Side) *limitPrice {
+	if side == Bid {
+		return b.bestBid
+	}
+	return b.bestAsk
+}
+
+// behind returns the price one tick behind the opposite side's best price,
+// the best price an order on the given side can rest at without matching.
+// It is false if there is no such price.
+func behind(side Side, opposite, tick Price) (Price, bool) {
+	if side == Bid {
+		return opposite - tick, opposite > tick
+	}
+	return opposite + tick, opposite <= ^Price(0)-tick
+}
+
+// slide returns the price a post-only order on the given side slides to, one
+// tick behind the opposite side's best price. It is false if there is no such
+// price inside the instrument's price band.
+func (b *Book) slide(side Side, opposite Price) (Price, bool) {
+	price, ok := behind(side, opposite, b.instrument.tick())
+	return price, ok && b.instrument.checkPrice(price) == nil
+}
+
+// next returns the next best price limit after lim on the given side.
+func next(side Side, lim *limitPrice) *limitPrice {
+	if side == Bid {
+		return lim.lower()
+	}
+	return lim.higher()
+}
+
+// limit returns the price limit a resting order belongs to.
+func (b *Book) limit(o *order) *limitPrice {
+	if o.side == Bid {
+		return b.bidMap[o.price]
+	}
+	return b.askMap[o.price]
+}
+
+// rest adds an order to its side of the book, creating its price limit if needed.
+// An iceberg order larger than its clip puts the rest of its size in reserve.
+func (b *Book) rest(o *order) {
+	if o.display != 0 && o.size > o.display {
+		o.hidden += o.size - o.display
+		o.size = o.display
+	}
+	b.orderMap[o.id] = o
+	b.own(o)
+	b.schedule(o)
+
+	var (
+		lim *limitPrice
+		ok  bool
+	)
+	if o.side == Bid {
+		// Check if the price limit already exists.
+		lim, ok = b.bidMap[o.price]
+		if !ok {
+			// Doesn't exist, add new limit to tree.
+			lim = b.bidTree.addLimit(o.price)
+			b.bidMap[o.price] = lim
+		}
+		// Adjust best bid if needed.
+		if b.bestBid == nil || o.price > b.bestBid.price {
+			b.bestBid = lim
+		}
+	} else {
+		// Check if the price limit already exists.
+		lim, ok = b.askMap[o.price]
+		if !ok {
+			// Doesn't exist, add new limit to tree.
+			lim = b.askTree.addLimit(o.price)
+			b.askMap[o.price] = lim
 		}
+		// Adjust best ask if needed.
+		if b.bestAsk == nil || o.price < b.bestAsk.price {
+			b.bestAsk = lim
+		}
+	}
+	if !ok {
+		b.emitLevel(LevelCreated, o.side, lim)
+	}
+	lim.orders.add(o)
+	b.emitOrder(OrderAdded, o, lim)
+}
 
-		if potentialmatch.size <= remaining {
-			// Fill existing bid order and remove from map.
-			remaining -= potentialmatch.size
-			delete(b.orderMap, potentialmatch.id)
-			b.bestBid.orders.remove(0)
-			matches = append(matches, Execution{
-				OrderID:           potentialmatch.id,
-				FilledQuantity:    potentialmatch.size,
-				RemainingQuantity: 0,
-			})
-		} else {
-			// Partial fill the existing bid order and move on.
-			matches = append(matches, Execution{
-				OrderID:           potentialmatch.id,
-				FilledQuantity:    remaining,
-				RemainingQuantity: potentialmatch.size - remaining,
-			})
-			potentialmatch.size -= remaining
-			remaining = 0
+// deleteLimit removes an empty price limit from the price map and from
+// the bid/ask tree. If it is the best bid/ask, it is replaced with the next best.
+func (b *Book) deleteLimit(side Side, lim *limitPrice) {
+	if side == Bid {
+		if b.bestBid == lim {
+			b.bestBid = next(side, lim)
 		}
+		delete(b.bidMap, lim.price)
+		b.bidTree.removeLimit(lim.price)
+	} else {
+		if b.bestAsk == lim {
+			b.bestAsk = next(side, lim)
+		}
+		delete(b.askMap, lim.price)
+		b.askTree.removeLimit(lim.price)
+	}
+	b.emitLevel(LevelRemoved, side, lim)
+}
+
+// Amend changes the price and size of a resting order, keeping its id.
+// The size is the new open quantity of the order, including the reserve
+// of an iceberg order.
+//
+// Reducing the size at the same price keeps the order's place in the queue.
+// Increasing the size or changing the price sends it to the back of the queue
+// at its new price, and if the new price crosses the book it is matched first,
+// as if it had just been submitted, unless the book is in an auction. The
+// returned executions start with a Replaced report for the order, followed by
+// any matches. Orders that expired before the amendment arrived are expired
+// first, the order itself included.
+//
+// A post-only order amended to a price that would take liquidity is treated as
+// on arrival: the amendment is Rejected, leaving the order as it was, or the
+// order slides to the best price it can rest at.
+func (b *Book) Amend(id OrderID, price Price, size Quantity) ([]Execution, error) {
+	var matches []Execution
+	reject := func(err error) ([]Execution, error) {
+		return matches, &OrderError{Op: "amend", ID: id, Order: Order{Price: price, Size: size}, Err: err}
+	}
+	switch {
+	case price == 0:
+		return reject(ErrInvalidPrice)
+	case size == 0:
+		return reject(ErrInvalidSize)
+	}
+	if err := b.instrument.checkPrice(price); err != nil {
+		return reject(err)
+	}
+	if err := b.instrument.checkSize(size); err != nil {
+		return reject(err)
+	}
+
+	o, ok := b.orderMap[id]
+	if !ok {
+		return reject(ErrUnknownOrder)
+	}
+
+	now := b.now()
+	if err := b.journal.amend(id, price, size, now); err != nil {
+		return reject(err)
 	}
+	return b.amend(o, price, size, now), nil
+}
+
+// amend applies a validated amendment to a resting order.
+func (b *Book) amend(o *order, price Price, size Quantity, now time.Time) []Execution {
+	id := o.id
+	b.at = now
+	matches := b.expire(now)
+	if _, ok := b.orderMap[id]; !ok {
+		// Too late.
+		return matches
+	}
+
+	// Post-only orders must not take liquidity when amended either.
+	if best := b.best(!o.side); o.postOnly != Taker && b.phase == Continuous &&
+		best != nil && crosses(o.side, price, best.price) {
+		slid, ok := b.slide(o.side, best.price)
+		if o.postOnly == PostOnlyReject || !ok {
+			matches = append(matches, Execution{OrderID: id, Type: Rejected, Side: o.side})
+			return stamp(matches, now)
+		}
+		price = slid
+	}
+
+	matches = append(matches, Execution{OrderID: id,
+		Type:              Replaced,
+		Side:              o.side,
+		RemainingQuantity: size,
+		Price:             price})
 
-	return askSize - remaining, matches
+	// Keep priority when only reducing the order.
+	if price == o.price && size <= o.size+o.hidden {
+		if size < o.size+o.hidden {
+			b.reduce(o, b.limit(o), o.size+o.hidden-size)
+		}
+		return stamp(matches, now)
+	}
+
+	// Lose priority otherwise, take the order out and treat it as new.
+	b.cancel(o, b.limit(o))
+	o.price = price
+	o.size = size
+	o.hidden = 0
+	o.time = now
+
+	if b.phase == Continuous {
+		matches = append(matches, b.match(o, price, 0)...)
+	}
+	if o.size != 0 {
+		b.rest(o)
+	}
+	return stamp(append(matches, b.trigger(now)...), now)
 }
 
-// Cancel order.
+// Cancel order, resting or waiting to be triggered.
 func (b *Book) Cancel(id OrderID) (bool, error) {
 
 	// Check existence in map and return if not in.
 	order, orderExists := b.orderMap[id]
+	stop, stopExists := b.stopMap[id]
+	if !orderExists && !stopExists {
+		return false, &OrderError{Op: "cancel", ID: id, Err: ErrUnknownOrder}
+	}
+
 	if !orderExists {
-		return false, errors.New("order does not exist")
+		order = stop
 	}
+	now := b.now()
+	if err := b.journal.cancel(id, now); err != nil {
+		return false, &OrderError{Op: "cancel", ID: id, Err: err}
+	}
+	b.withdraw(order, now)
+	return true, nil
+}
 
-	p := order.price
-	s := order.side
+// withdraw cancels a resting or stop order at now.
+func (b *Book) withdraw(o *order, now time.Time) {
+	b.at = now
+	if o.stop != nil {
+		b.release(o)
+		return
+	}
+	b.cancel(o, b.limit(o))
+}
 
-	// Remove order from orders map and remove order from its list.
-	var (
-		lim         *limitPrice
-		priceExists bool
-	)
-	if s == Bid {
-		lim, priceExists = b.bidMap[p]
-	} else {
-		lim, priceExists = b.askMap[p]
+// cancel removes a resting order from its price limit.
+func (b *Book) cancel(o *order, lim *limitPrice) {
+	b.unlink(o, lim)
+
+	// If that order was the last in its price level, remove that price level.
+	if lim.orders.Size() == 0 {
+		b.deleteLimit(o.side, lim)
 	}
-	if !priceExists {
-		return false, errors.New("price does not exist, this is should not happen")
+}
+
+// reduce takes qty off a resting order, less than all of it,
+// drawing on an iceberg order's reserve first.
+func (b *Book) reduce(o *order, lim *limitPrice, qty Quantity) {
+	if qty <= o.hidden {
+		// The market never saw the reserve.
+		o.hidden -= qty
+		lim.orders.hidden -= qty
+		return
 	}
+	qty -= o.hidden
+	lim.orders.hidden -= o.hidden
+	o.hidden = 0
+	o.size -= qty
+	lim.orders.volume -= qty
+	b.emitOrder(OrderReduced, o, lim)
+}
 
-	delete(b.orderMap, id)
-	lim.orders.removeID(id)
+// unlink removes a resting order from the order map and its price limit's
+// queue, leaving the limit in place even if it is now empty.
+func (b *Book) unlink(o *order, lim *limitPrice) {
+	b.forget(o)
+	lim.orders.removeOrder(o)
+	b.emitOrder(OrderDeleted, o, lim)
+}
 
-	// If that order was the last in its price level, remove that price level
-	// from the price level map and from the bid/ask tree.
-	//
-	// If a removed price level is the best bid/ask, the best bid/ask need to
-	// be replaced with the next best.
-	if lim.orders.Size() == 0 {
-		if s == Bid {
-			//
-			if b.bestBid.price == p {
-				b.bestBid = b.bestBid.lower()
-			}
-			delete(b.bidMap, p)
-			b.bidTree.removeLimit(p)
-		} else {
-			//
-			if b.bestAsk.price == p {
-				b.bestAsk = b.bestAsk.higher()
-			}
-			delete(b.askMap, p)
-			b.askTree.removeLimit(p)
-		}
+// forget removes an order leaving the book from the order map
+// and the indexes kept alongside it.
+func (b *Book) forget(o *order) {
+	delete(b.orderMap, o.id)
+	b.disown(o)
+	b.unschedule(o)
+}
+
+// Top of the book. A side with no orders is reported as zero.
+func (b *Book) Top() (bid, ask Price) {
+	if b.bestBid != nil {
+		bid = b.bestBid.price
 	}
-	return true, nil
+	if b.bestAsk != nil {
+		ask = b.bestAsk.price
+	}
+	return bid, ask
 }
 
-// Top of the book.
-func (b *Book) Top() (bid, ask uint) {
-	return b.bestBid.price, b.bestAsk.price
+// LastPrice returns the price of the last trade in the book,
+// or zero if nothing has traded yet.
+func (b *Book) LastPrice() Price {
+	return b.last
 }
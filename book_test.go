@@ -0,0 +1,738 @@
+package orderbook
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testBook returns a book on a clock that stands still at the zero time,
+// so that executions and events compare without their times.
+func testBook(cfg Config) *Book {
+	cfg.Clock = &ManualClock{}
+	return New(cfg)
+}
+
+func Test_MarketOrder(t *testing.T) {
+	b := testBook(Config{})
+	b.Submit(Ask, 101, 5)
+	b.Submit(Ask, 102, 5)
+	b.Submit(Ask, 105, 5)
+	b.Submit(Bid, 99, 5)
+
+	id, execs, err := b.SubmitOrder(Order{Side: Bid, Type: Market, Size: 12})
+	assert.NoError(t, err)
+	assert.Len(t, execs, 6)
+	assert.Equal(t, Execution{OrderID: id, FilledQuantity: 2, Price: 105,
+		TradeID: 3, Counterparty: 3, Liquidity: LiquidityRemoved}, execs[5])
+
+	bid, ask := b.Top()
+	assert.Equal(t, Price(99), bid)
+	assert.Equal(t, Price(105), ask)
+
+	// Sweep everything, the remainder is cancelled and nothing rests.
+	id, execs, err = b.SubmitOrder(Order{Side: Ask, Type: Market, Size: 8})
+	assert.NoError(t, err)
+	assert.Equal(t, Execution{OrderID: id, Side: Ask, FilledQuantity: 5, RemainingQuantity: 3, Price: 99,
+		TradeID: 4, Counterparty: 4, Liquidity: LiquidityRemoved}, execs[1])
+	assert.Equal(t, Execution{OrderID: id, Type: Cancelled, Side: Ask, CancelledQuantity: 3}, execs[2])
+	bid, ask = b.Top()
+	assert.Equal(t, Price(0), bid)
+	assert.Equal(t, Price(105), ask)
+	assert.Len(t, b.orderMap, 1)
+}
+
+func Test_MarketOrderProtection(t *testing.T) {
+	b := Init()
+	b.Submit(Bid, 100, 5)
+	b.Submit(Bid, 99, 5)
+	b.Submit(Bid, 97, 5)
+
+	_, execs, _ := b.SubmitOrder(Order{Side: Ask, Type: Market, Size: 15,
+		Protection: Protection{MaxLevels: 1}})
+	assert.Equal(t, Quantity(10), execs[len(execs)-1].CancelledQuantity)
+
+	_, execs, _ = b.SubmitOrder(Order{Side: Ask, Type: Market, Size: 10,
+		Protection: Protection{MaxSlippage: 1}})
+	assert.Equal(t, Quantity(5), execs[len(execs)-2].RemainingQuantity)
+	assert.Equal(t, Quantity(5), execs[len(execs)-1].CancelledQuantity)
+
+	bid, _ := b.Top()
+	assert.Equal(t, Price(97), bid)
+}
+
+func Test_TimeInForce(t *testing.T) {
+	b := testBook(Config{})
+	b.Submit(Ask, 101, 5)
+	b.Submit(Ask, 102, 5)
+
+	// Not enough liquidity at or below 101, nothing happens.
+	id, execs, err := b.SubmitOrder(Order{Side: Bid, TimeInForce: FillOrKill, Price: 101, Size: 6})
+	assert.NoError(t, err)
+	assert.Equal(t, []Execution{{OrderID: id, Type: Cancelled, CancelledQuantity: 6}}, execs)
+	assert.Equal(t, Quantity(5), b.bestAsk.orders.first.size)
+
+	_, execs, _ = b.SubmitOrder(Order{Side: Bid, TimeInForce: FillOrKill, Price: 102, Size: 6})
+	assert.Len(t, execs, 4)
+	assert.Equal(t, Quantity(4), b.bestAsk.orders.first.size)
+
+	id, execs, _ = b.SubmitOrder(Order{Side: Bid, TimeInForce: ImmediateOrCancel, Price: 102, Size: 6})
+	assert.Equal(t, Execution{OrderID: id, Type: Cancelled, CancelledQuantity: 2}, execs[2])
+	bid, ask := b.Top()
+	assert.Equal(t, Price(0), bid)
+	assert.Equal(t, Price(0), ask)
+	assert.Empty(t, b.orderMap)
+}
+
+func Test_PostOnly(t *testing.T) {
+	b := testBook(Config{})
+	b.Submit(Ask, 101, 5)
+	b.Submit(Bid, 99, 5)
+
+	id, execs, err := b.SubmitOrder(Order{Side: Bid, Price: 101, Size: 5, PostOnly: PostOnlyReject})
+	assert.NoError(t, err)
+	assert.Equal(t, []Execution{{OrderID: id, Type: Rejected}}, execs)
+	assert.Len(t, b.orderMap, 2)
+
+	id, execs, err = b.SubmitOrder(Order{Side: Bid, Price: 103, Size: 5, PostOnly: PostOnlySlide})
+	assert.NoError(t, err)
+	assert.Equal(t, []Execution{{OrderID: id, Type: Repriced, RemainingQuantity: 5, Price: 100}}, execs)
+	bid, ask := b.Top()
+	assert.Equal(t, Price(100), bid)
+	assert.Equal(t, Price(101), ask)
+
+	// Passive post-only orders are untouched.
+	_, execs, _ = b.SubmitOrder(Order{Side: Ask, Price: 102, Size: 5, PostOnly: PostOnlySlide})
+	assert.Empty(t, execs)
+
+	// Amending them cannot take liquidity either.
+	execs, _ = b.Amend(id, 101, 5)
+	assert.Equal(t, []Execution{{OrderID: id, Type: Replaced, RemainingQuantity: 5, Price: 100}}, execs)
+	reject, _, _ := b.SubmitOrder(Order{Side: Bid, Price: 99, Size: 1, PostOnly: PostOnlyReject})
+	execs, _ = b.Amend(reject, 101, 1)
+	assert.Equal(t, []Execution{{OrderID: reject, Type: Rejected}}, execs)
+	info, _ := b.Order(reject)
+	assert.Equal(t, Price(99), info.Price)
+	assert.Equal(t, Quantity(5), b.bestAsk.orders.volume)
+}
+
+func Test_SelfTrade(t *testing.T) {
+	setup := func(mode SelfTradePrevention) *Book {
+		b := testBook(Config{SelfTrade: mode})
+		b.SubmitOrder(Order{Side: Ask, Price: 100, Size: 5, Owner: "a"})
+		b.SubmitOrder(Order{Side: Ask, Price: 100, Size: 5, Owner: "b"})
+		return b
+	}
+	bid := Order{Side: Bid, Price: 100, Size: 8, Owner: "a"}
+
+	b := setup(CancelNewest)
+	id, execs, _ := b.SubmitOrder(bid)
+	assert.Equal(t, []Execution{{OrderID: id, Type: SelfTradePrevented, CancelledQuantity: 8, Price: 100, Counterparty: 1}}, execs)
+	assert.Equal(t, Quantity(10), b.bestAsk.orders.volume)
+
+	b = setup(CancelOldest)
+	id, execs, _ = b.SubmitOrder(bid)
+	assert.Equal(t, []Execution{
+		{OrderID: 1, Type: SelfTradePrevented, Side: Ask, CancelledQuantity: 5, Price: 100, Counterparty: id},
+		{OrderID: 2, Side: Ask, FilledQuantity: 5, Price: 100, TradeID: 1, Counterparty: id, Liquidity: LiquidityAdded},
+		{OrderID: id, FilledQuantity: 5, RemainingQuantity: 3, Price: 100, TradeID: 1, Counterparty: 2, Liquidity: LiquidityRemoved},
+	}, execs)
+	bidPrice, ask := b.Top()
+	assert.Equal(t, Price(100), bidPrice)
+	assert.Equal(t, Price(0), ask)
+
+	b = setup(CancelBoth)
+	id, execs, _ = b.SubmitOrder(bid)
+	assert.Equal(t, []Execution{
+		{OrderID: 1, Type: SelfTradePrevented, Side: Ask, CancelledQuantity: 5, Price: 100, Counterparty: id},
+		{OrderID: id, Type: SelfTradePrevented, CancelledQuantity: 8, Price: 100, Counterparty: 1},
+	}, execs)
+	assert.Len(t, b.orderMap, 1)
+
+	b = setup(DecrementAndCancel)
+	id, execs, _ = b.SubmitOrder(bid)
+	assert.Equal(t, []Execution{
+		{OrderID: 1, Type: SelfTradePrevented, Side: Ask, CancelledQuantity: 5, Price: 100, Counterparty: id},
+		{OrderID: id, Type: SelfTradePrevented, RemainingQuantity: 3, CancelledQuantity: 5, Price: 100, Counterparty: 1},
+		{OrderID: 2, Side: Ask, FilledQuantity: 3, RemainingQuantity: 2, Price: 100, TradeID: 1, Counterparty: id, Liquidity: LiquidityAdded},
+		{OrderID: id, FilledQuantity: 3, Price: 100, TradeID: 1, Counterparty: 2, Liquidity: LiquidityRemoved},
+	}, execs)
+	assert.Equal(t, Quantity(2), b.bestAsk.orders.volume)
+
+	// Fill or kill orders only count liquidity they may trade with.
+	b = setup(CancelOldest)
+	_, execs, _ = b.SubmitOrder(Order{Side: Bid, Price: 100, Size: 8, Owner: "a", TimeInForce: FillOrKill})
+	assert.Equal(t, Cancelled, execs[0].Type)
+	assert.Len(t, b.orderMap, 2)
+
+	// Orders without an owner trade freely.
+	b = setup(CancelBoth)
+	_, execs, _ = b.SubmitOrder(Order{Side: Bid, Price: 100, Size: 8})
+	assert.Len(t, execs, 4)
+}
+
+func Test_Owners(t *testing.T) {
+	b := testBook(Config{})
+	b.SubmitOrder(Order{Side: Ask, Price: 102, Size: 1, Owner: "a"})
+	b.SubmitOrder(Order{Side: Bid, Price: 99, Size: 2, Owner: "a"})
+	b.SubmitOrder(Order{Side: Bid, Price: 100, Size: 3, Owner: "b"})
+	b.SubmitOrder(Order{Side: Bid, Price: 100, Size: 4, Owner: "a"})
+	b.SubmitOrder(Order{Side: Ask, Price: 101, Size: 5, Owner: "a"})
+	b.SubmitOrder(Order{Side: Ask, Price: 101, Size: 6})
+
+	var ids []OrderID
+	for _, o := range b.OrdersByOwner("a") {
+		ids = append(ids, o.ID)
+	}
+	assert.Equal(t, []OrderID{4, 2, 5, 1}, ids)
+	assert.Equal(t, 1, b.OrdersByOwner("a")[0].Position)
+	assert.Empty(t, b.OrdersByOwner("c"))
+
+	// Filled orders leave the index.
+	b.Submit(Bid, 101, 5)
+	assert.Len(t, b.OrdersByOwner("a"), 3)
+
+	execs, err := b.CancelAll("a", CancelFilter{OneSide: true, Side: Bid, MinPrice: 100})
+	assert.NoError(t, err)
+	assert.Equal(t, []Execution{{OrderID: 4, Type: Cancelled, CancelledQuantity: 4, Price: 100}}, execs)
+
+	execs, _ = b.CancelAll("a", CancelFilter{})
+	assert.Len(t, execs, 2)
+	assert.Empty(t, b.OrdersByOwner("a"))
+	assert.Empty(t, b.owners["a"])
+	assert.Len(t, b.orderMap, 2)
+	bid, ask := b.Top()
+	assert.Equal(t, Price(100), bid)
+	assert.Equal(t, Price(101), ask)
+
+	// Stop orders belong to their owner too.
+	stop, _, _ := b.SubmitOrder(Order{Side: Ask, Type: StopLimit, StopPrice: 95, Price: 94, Size: 2, Owner: "a"})
+	assert.Equal(t, []OrderInfo{{ID: stop, Side: Ask, Price: 94, Size: 2, Owner: "a", StopPrice: 95}}, b.OrdersByOwner("a"))
+	execs, _ = b.CancelAll("a", CancelFilter{})
+	assert.Equal(t, []Execution{{OrderID: stop, Type: Cancelled, Side: Ask, CancelledQuantity: 2, Price: 95}}, execs)
+	assert.Empty(t, b.stopMap)
+	assert.Empty(t, b.owners["a"])
+}
+
+func Test_Iceberg(t *testing.T) {
+	b := testBook(Config{})
+	id, _, _ := b.SubmitOrder(Order{Side: Ask, Price: 100, Size: 10, DisplaySize: 4})
+	b.Submit(Ask, 100, 2)
+	assert.Equal(t, []Level{{Price: 100, Size: 6, Orders: 2}}, b.Depth(Ask, 0))
+	info, _ := b.Order(id)
+	assert.Equal(t, Quantity(6), info.Hidden)
+	assert.Zero(t, b.DepthByOrder(Ask, 0)[0].Orders[0].Hidden)
+
+	// Filling the clip refills it from the reserve at the back of the queue.
+	_, execs, _ := b.Submit(Bid, 100, 5)
+	assert.Equal(t, Execution{OrderID: id, Side: Ask, FilledQuantity: 4, RemainingQuantity: 6, HiddenQuantity: 2,
+		Price: 100, TradeID: 1, Counterparty: 3, Liquidity: LiquidityAdded}, execs[0])
+	assert.Equal(t, OrderID(2), execs[2].OrderID)
+	assert.Equal(t, Quantity(1), execs[2].FilledQuantity)
+	info, _ = b.Order(id)
+	assert.Equal(t, OrderInfo{ID: id, Side: Ask, Price: 100, Size: 4, Hidden: 2, Time: info.Time, Position: 1}, info)
+
+	// Reductions come out of the reserve first.
+	b.Amend(id, 100, 5)
+	info, _ = b.Order(id)
+	assert.Equal(t, Quantity(4), info.Size)
+	assert.Equal(t, Quantity(1), info.Hidden)
+	assert.Equal(t, 1, info.Position)
+
+	// Fill or kill orders can count on the reserve.
+	_, execs, _ = b.SubmitOrder(Order{Side: Bid, Price: 100, Size: 6, TimeInForce: FillOrKill})
+	assert.Len(t, execs, 6)
+	assert.Empty(t, b.orderMap)
+	assert.Nil(t, b.bestAsk)
+
+	_, _, err := b.SubmitOrder(Order{Side: Bid, Type: Market, Size: 6, DisplaySize: 1})
+	assert.True(t, errors.Is(err, ErrInvalidDisplaySize))
+	// The refilled clip queues behind the owner's own order, so a fill or
+	// kill order that would trade with it cannot count on the reserve.
+	b = testBook(Config{SelfTrade: CancelBoth})
+	b.SubmitOrder(Order{Side: Bid, Price: 100, Size: 4, DisplaySize: 1})
+	b.SubmitOrder(Order{Side: Bid, Price: 100, Size: 1, Owner: "a"})
+	id, execs, _ = b.SubmitOrder(Order{Side: Ask, Price: 100, Size: 2, Owner: "a", TimeInForce: FillOrKill})
+	assert.Equal(t, []Execution{{OrderID: id, Type: Cancelled, Side: Ask, CancelledQuantity: 2}}, execs)
+	assert.Equal(t, Quantity(5), b.bestBid.orders.volume+b.bestBid.orders.hidden)
+}
+
+func Test_Stops(t *testing.T) {
+	b := testBook(Config{})
+	b.Submit(Ask, 100, 1)
+	b.Submit(Ask, 101, 1)
+	b.Submit(Ask, 102, 5)
+	stop, execs, _ := b.SubmitOrder(Order{Side: Bid, Type: Stop, StopPrice: 100, Size: 1})
+	assert.Empty(t, execs)
+	stopLimit, _, _ := b.SubmitOrder(Order{Side: Bid, Type: StopLimit, StopPrice: 101, Price: 102, Size: 2})
+	sell, _, _ := b.SubmitOrder(Order{Side: Ask, Type: Stop, StopPrice: 90, Size: 1})
+	assert.Len(t, b.orderMap, 3)
+
+	// Stops are not resting orders, but their ids are taken.
+	_, ok := b.Order(stop)
+	assert.False(t, ok)
+	_, _, err := b.SubmitOrder(Order{ID: stop, Side: Bid, Price: 90, Size: 1})
+	assert.True(t, errors.Is(err, ErrDuplicateOrderID))
+
+	// Each triggered stop trades and triggers the next.
+	_, execs, _ = b.Submit(Bid, 100, 1)
+	assert.Equal(t, []Execution{
+		{OrderID: 1, Side: Ask, FilledQuantity: 1, Price: 100, TradeID: 1, Counterparty: 7, Liquidity: LiquidityAdded},
+		{OrderID: 7, FilledQuantity: 1, Price: 100, TradeID: 1, Counterparty: 1, Liquidity: LiquidityRemoved},
+		{OrderID: stop, Type: Triggered, RemainingQuantity: 1, Price: 100},
+		{OrderID: 2, Side: Ask, FilledQuantity: 1, Price: 101, TradeID: 2, Counterparty: stop, Liquidity: LiquidityAdded},
+		{OrderID: stop, FilledQuantity: 1, Price: 101, TradeID: 2, Counterparty: 2, Liquidity: LiquidityRemoved},
+		{OrderID: stopLimit, Type: Triggered, RemainingQuantity: 2, Price: 101},
+		{OrderID: 3, Side: Ask, FilledQuantity: 2, RemainingQuantity: 3, Price: 102, TradeID: 3, Counterparty: stopLimit, Liquidity: LiquidityAdded},
+		{OrderID: stopLimit, FilledQuantity: 2, Price: 102, TradeID: 3, Counterparty: 3, Liquidity: LiquidityRemoved},
+	}, execs)
+	assert.Equal(t, Price(102), b.LastPrice())
+	assert.Len(t, b.stopMap, 1)
+
+	ok, err = b.Cancel(sell)
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	assert.Empty(t, b.stopMap)
+	assert.Nil(t, b.sellStops.first)
+
+	_, _, err = b.SubmitOrder(Order{Side: Bid, Type: StopLimit, StopPrice: 100, Size: 1})
+	assert.True(t, errors.Is(err, ErrInvalidPrice))
+	_, _, err = b.SubmitOrder(Order{Side: Bid, Type: Stop, Size: 1})
+	assert.True(t, errors.Is(err, ErrInvalidStopPrice))
+	_, _, err = b.SubmitOrder(Order{Side: Bid, Price: 100, StopPrice: 100, Size: 1})
+	assert.True(t, errors.Is(err, ErrInvalidStopPrice))
+
+	// A trade through a stop fires it, even if later trades move away.
+	b = testBook(Config{})
+	b.Submit(Ask, 105, 1)
+	b.Submit(Bid, 105, 1)
+	b.Submit(Ask, 102, 1)
+	b.Submit(Ask, 106, 1)
+	sell, _, _ = b.SubmitOrder(Order{Side: Ask, Type: Stop, StopPrice: 103, Size: 1})
+	_, execs, _ = b.Submit(Bid, 106, 2)
+	assert.Equal(t, Price(106), b.LastPrice())
+	assert.Equal(t, Execution{OrderID: sell, Type: Triggered, Side: Ask, RemainingQuantity: 1, Price: 102}, execs[4])
+	assert.Empty(t, b.stopMap)
+}
+
+func Test_TrailingStops(t *testing.T) {
+	b := testBook(Config{})
+	trade := func(price Price) []Execution {
+		b.Submit(Ask, price, 1)
+		_, execs, _ := b.Submit(Bid, price, 1)
+		return execs
+	}
+
+	_, _, err := b.SubmitOrder(Order{Side: Ask, Type: Stop, Size: 1, Trailing: Trailing{Offset: 3}})
+	assert.True(t, errors.Is(err, ErrInvalidTrailingStop))
+	trade(100)
+	_, _, err = b.SubmitOrder(Order{Side: Ask, Type: Stop, StopPrice: 97, Size: 1, Trailing: Trailing{Offset: 3}})
+	assert.True(t, errors.Is(err, ErrInvalidTrailingStop))
+	_, _, err = b.SubmitOrder(Order{Side: Ask, Type: Stop, Size: 1, Trailing: Trailing{Offset: 100}})
+	assert.True(t, errors.Is(err, ErrInvalidTrailingStop))
+	_, _, err = b.SubmitOrder(Order{Side: Bid, Type: Stop, Size: 1, Trailing: Trailing{BasisPoints: 99}})
+	assert.True(t, errors.Is(err, ErrInvalidTrailingStop))
+
+	sell, _, _ := b.SubmitOrder(Order{Side: Ask, Type: Stop, Size: 1, Trailing: Trailing{Offset: 3}})
+	buy, _, _ := b.SubmitOrder(Order{Side: Bid, Type: StopLimit, Price: 115, Size: 1, Trailing: Trailing{BasisPoints: 1000}})
+	assert.Equal(t, Price(97), b.stopMap[sell].price)
+	assert.Equal(t, Price(110), b.stopMap[buy].price)
+
+	// Stops follow the price one way only.
+	trade(105)
+	trade(104)
+	assert.Equal(t, Price(102), b.stopMap[sell].price)
+	assert.Equal(t, Price(110), b.stopMap[buy].price)
+
+	execs := trade(95)
+	assert.Equal(t, Execution{OrderID: sell, Type: Triggered, Side: Ask, RemainingQuantity: 1, Price: 95}, execs[2])
+	assert.Equal(t, Cancelled, execs[3].Type)
+	assert.Equal(t, Price(104), b.stopMap[buy].price)
+	assert.Equal(t, Price(109), b.stopMap[buy].stop.Price)
+	assert.Len(t, b.sellTrails.orders, 0)
+
+	b.Submit(Ask, 109, 1)
+	execs = trade(104)
+	assert.Equal(t, Triggered, execs[2].Type)
+	assert.Equal(t, buy, execs[4].OrderID)
+	assert.Equal(t, Price(109), b.LastPrice())
+	assert.Empty(t, b.stopMap)
+}
+
+func Test_Clock(t *testing.T) {
+	start := time.Unix(0, 1577872800000000001)
+	clock := NewManualClock(start)
+	b := New(Config{Clock: clock})
+	var events []Event
+	b.Subscribe(func(e Event) { events = append(events, e) })
+
+	first, _, _ := b.Submit(Ask, 100, 1)
+	clock.Advance(time.Nanosecond)
+	second, _, _ := b.Submit(Ask, 100, 1)
+	o1, _ := b.Order(first)
+	o2, _ := b.Order(second)
+	assert.Equal(t, start, o1.Time)
+	assert.True(t, o2.Time.Sub(o1.Time) == time.Nanosecond)
+
+	clock.Advance(time.Second)
+	_, execs, _ := b.Submit(Bid, 100, 1)
+	for _, e := range execs {
+		assert.Equal(t, clock.Now(), e.Time)
+	}
+	assert.Equal(t, start, events[0].Time)
+	assert.Equal(t, clock.Now(), events[len(events)-1].Time)
+
+	clock.Advance(time.Second)
+	b.Cancel(second)
+	assert.Equal(t, clock.Now(), events[len(events)-1].Time)
+}
+
+func Test_Expiry(t *testing.T) {
+	clock := NewManualClock(time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC))
+	b := New(Config{Clock: clock})
+	at := func(h, m int) time.Time { return time.Date(2020, 1, 1, h, m, 0, 0, time.UTC) }
+
+	gtd, _, _ := b.SubmitOrder(Order{Side: Bid, Price: 100, Size: 1, TimeInForce: GoodTillDate, ExpireTime: at(10, 30)})
+	day, _, _ := b.SubmitOrder(Order{Side: Bid, Price: 99, Size: 1, TimeInForce: Day})
+	b.Submit(Bid, 98, 1)
+	stop, _, _ := b.SubmitOrder(Order{Side: Ask, Type: Stop, StopPrice: 90, Size: 1, TimeInForce: GoodTillDate, ExpireTime: at(10, 15)})
+
+	_, _, err := b.SubmitOrder(Order{Side: Bid, Price: 100, Size: 1, TimeInForce: GoodTillDate, ExpireTime: at(9, 0)})
+	assert.True(t, errors.Is(err, ErrInvalidExpireTime))
+	_, _, err = b.SubmitOrder(Order{Side: Bid, Price: 100, Size: 1, ExpireTime: at(11, 0)})
+	assert.True(t, errors.Is(err, ErrInvalidExpireTime))
+
+	clock.Set(at(10, 20))
+	execs, err := b.Expire()
+	assert.NoError(t, err)
+	assert.Equal(t, []Execution{{OrderID: stop, Type: Expired, Side: Ask, CancelledQuantity: 1, Price: 90, Time: at(10, 20)}}, execs)
+	assert.Empty(t, b.stopMap)
+
+	// Expired orders are removed before the next order can trade with them.
+	clock.Advance(10 * time.Minute)
+	_, execs, _ = b.Submit(Ask, 100, 1)
+	assert.Equal(t, []Execution{{OrderID: gtd, Type: Expired, CancelledQuantity: 1, Price: 100, Time: at(10, 30)}}, execs)
+	bid, ask := b.Top()
+	assert.Equal(t, Price(99), bid)
+	assert.Equal(t, Price(100), ask)
+
+	// Day orders last until the end of the session.
+	midnight := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	clock.Set(midnight)
+	execs, _ = b.Expire()
+	assert.Equal(t, []Execution{{OrderID: day, Type: Expired, CancelledQuantity: 1, Price: 99, Time: midnight}}, execs)
+	assert.Empty(t, b.expiries)
+	assert.Len(t, b.orderMap, 2)
+}
+
+func Test_Auction(t *testing.T) {
+	clock := NewManualClock(time.Date(2020, 1, 1, 8, 0, 0, 0, time.UTC))
+	b := New(Config{Clock: clock})
+	submit := func(side Side, price Price, size Quantity) OrderID {
+		clock.Advance(time.Minute)
+		id, execs, err := b.Submit(side, price, size)
+		assert.NoError(t, err)
+		assert.Empty(t, execs)
+		return id
+	}
+
+	assert.NoError(t, b.StartAuction(0))
+	assert.Equal(t, Auction, b.Phase())
+	assert.True(t, errors.Is(b.StartAuction(0), ErrAuction))
+	_, _, err := b.SubmitOrder(Order{Side: Bid, Type: Market, Size: 1})
+	assert.True(t, errors.Is(err, ErrAuction))
+	_, _, err = b.SubmitOrder(Order{Side: Bid, Price: 100, Size: 1, TimeInForce: ImmediateOrCancel})
+	assert.True(t, errors.Is(err, ErrAuction))
+
+	// Crossing orders rest until the uncross.
+	b1 := submit(Bid, 102, 3)
+	b2 := submit(Bid, 101, 2)
+	a1 := submit(Ask, 100, 2)
+	a2 := submit(Ask, 101, 4)
+	bid, ask := b.Top()
+	assert.Equal(t, Price(102), bid)
+	assert.Equal(t, Price(100), ask)
+
+	// 101 trades 5, more than 100 or 102.
+	price, volume := b.ClearingPrice()
+	assert.Equal(t, Price(101), price)
+	assert.Equal(t, Quantity(5), volume)
+
+	now := time.Date(2020, 1, 1, 9, 0, 0, 0, time.UTC)
+	clock.Set(now)
+	execs, err := b.Uncross()
+	assert.NoError(t, err)
+	assert.Equal(t, []Execution{
+		{OrderID: b1, Side: Bid, FilledQuantity: 2, RemainingQuantity: 1, Price: 101, TradeID: 1, Counterparty: a1, Time: now},
+		{OrderID: a1, Side: Ask, FilledQuantity: 2, Price: 101, TradeID: 1, Counterparty: b1, Time: now},
+		{OrderID: b1, Side: Bid, FilledQuantity: 1, Price: 101, TradeID: 2, Counterparty: a2, Time: now},
+		{OrderID: a2, Side: Ask, FilledQuantity: 1, RemainingQuantity: 3, Price: 101, TradeID: 2, Counterparty: b1, Time: now},
+		{OrderID: b2, Side: Bid, FilledQuantity: 2, Price: 101, TradeID: 3, Counterparty: a2, Time: now},
+		{OrderID: a2, Side: Ask, FilledQuantity: 2, RemainingQuantity: 1, Price: 101, TradeID: 3, Counterparty: b2, Time: now},
+	}, execs)
+	assert.Equal(t, Continuous, b.Phase())
+	assert.Equal(t, Price(101), b.LastPrice())
+	bid, ask = b.Top()
+	assert.Equal(t, Price(0), bid)
+	assert.Equal(t, Price(101), ask)
+	_, err = b.Uncross()
+	assert.True(t, errors.Is(err, ErrNoAuction))
+
+	// Back to continuous matching.
+	_, execs, _ = b.Submit(Bid, 101, 1)
+	assert.Len(t, execs, 2)
+
+	// Prices that trade the same with the same imbalance go to the one
+	// nearest the reference price, or the last trade without one.
+	assert.NoError(t, b.StartAuction(0))
+	submit(Bid, 102, 1)
+	submit(Ask, 99, 1)
+	price, volume = b.ClearingPrice()
+	assert.Equal(t, Price(102), price)
+	assert.Equal(t, Quantity(1), volume)
+	b.Uncross()
+
+	assert.NoError(t, b.StartAuction(100))
+	submit(Bid, 102, 1)
+	submit(Ask, 99, 1)
+	price, _ = b.ClearingPrice()
+	assert.Equal(t, Price(99), price)
+	// Orders still crossing after self trade prevention clear at a new price.
+	b = testBook(Config{SelfTrade: CancelOldest})
+	b.StartAuction(0)
+	b.Submit(Bid, 98, 1)
+	b.SubmitOrder(Order{Side: Bid, Price: 99, Size: 3, Owner: "a"})
+	b.Submit(Bid, 97, 3)
+	b.SubmitOrder(Order{Side: Ask, Price: 98, Size: 1, Owner: "a"})
+	price, volume = b.ClearingPrice()
+	assert.Equal(t, Price(99), price)
+	assert.Equal(t, Quantity(1), volume)
+	execs, _ = b.Uncross()
+	assert.Equal(t, []Execution{
+		{OrderID: 2, Type: SelfTradePrevented, CancelledQuantity: 3, Price: 99, Counterparty: 4},
+		{OrderID: 1, FilledQuantity: 1, Price: 98, TradeID: 1, Counterparty: 4},
+		{OrderID: 4, Side: Ask, FilledQuantity: 1, Price: 98, TradeID: 1, Counterparty: 1},
+	}, execs)
+	bid, ask = b.Top()
+	assert.Equal(t, Price(97), bid)
+	assert.Equal(t, Price(0), ask)
+}
+
+func Test_Amend(t *testing.T) {
+	b := testBook(Config{})
+	first, _, _ := b.Submit(Bid, 100, 5)
+	second, _, _ := b.Submit(Bid, 100, 5)
+
+	// Reducing keeps priority.
+	execs, err := b.Amend(second, 100, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []Execution{{OrderID: second, Type: Replaced, RemainingQuantity: 3, Price: 100}}, execs)
+	assert.Equal(t, second, b.bestBid.orders.last.id)
+
+	// Increasing loses it.
+	_, err = b.Amend(first, 100, 6)
+	assert.NoError(t, err)
+	assert.Equal(t, second, b.bestBid.orders.first.id)
+	assert.Equal(t, first, b.bestBid.orders.last.id)
+
+	// Moving to a marketable price matches straight away.
+	b.Submit(Ask, 101, 4)
+	execs, err = b.Amend(second, 101, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []Execution{
+		{OrderID: second, Type: Replaced, RemainingQuantity: 3, Price: 101},
+		{OrderID: 3, Side: Ask, FilledQuantity: 3, RemainingQuantity: 1, Price: 101,
+			TradeID: 1, Counterparty: second, Liquidity: LiquidityAdded},
+		{OrderID: second, FilledQuantity: 3, Price: 101,
+			TradeID: 1, Counterparty: 3, Liquidity: LiquidityRemoved},
+	}, execs)
+	_, ok := b.orderMap[second]
+	assert.False(t, ok)
+	bid, ask := b.Top()
+	assert.Equal(t, Price(100), bid)
+	assert.Equal(t, Price(101), ask)
+
+	_, err = b.Amend(second, 101, 3)
+	assert.Error(t, err)
+}
+
+func Test_IDs(t *testing.T) {
+	b := Init()
+	id, _, _ := b.Submit(Bid, 100, 5)
+	assert.Equal(t, OrderID(1), id)
+
+	// Caller supplied ids must be free, generated ones skip them.
+	id, _, err := b.SubmitOrder(Order{ID: 2, Side: Bid, Price: 100, Size: 5})
+	assert.NoError(t, err)
+	assert.Equal(t, OrderID(2), id)
+	_, _, err = b.SubmitOrder(Order{ID: 2, Side: Bid, Price: 100, Size: 5})
+	assert.Error(t, err)
+	id, _, _ = b.Submit(Bid, 100, 5)
+	assert.Equal(t, OrderID(3), id)
+
+	// Seeded generators are reproducible.
+	x, y := New(Config{IDs: NewRandomIDs(7)}), New(Config{IDs: NewRandomIDs(7)})
+	for i := 0; i < 10; i++ {
+		idx, _, _ := x.Submit(Ask, 100, 1)
+		idy, _, _ := y.Submit(Ask, 100, 1)
+		assert.Equal(t, idx, idy)
+	}
+}
+
+func Test_Depth(t *testing.T) {
+	b := Init()
+	b.Submit(Ask, 103, 1)
+	b.Submit(Ask, 101, 5)
+	b.Submit(Ask, 102, 2)
+	b.Submit(Ask, 101, 3)
+	b.Submit(Bid, 99, 4)
+	b.Submit(Bid, 100, 6)
+
+	assert.Equal(t, []Level{{101, 8, 2}, {102, 2, 1}}, b.Depth(Ask, 2))
+	assert.Equal(t, []Level{{100, 6, 1}, {99, 4, 1}}, b.Depth(Bid, 0))
+	assert.Equal(t, []Level{{101, 8, 2}, {102, 2, 1}}, b.DepthTo(Ask, 102))
+	assert.Equal(t, []Level{{100, 6, 1}}, b.DepthTo(Bid, 100))
+
+	// Volume follows fills, amendments and cancels.
+	b.Submit(Bid, 101, 6)
+	id, _, _ := b.Submit(Ask, 102, 4)
+	b.Amend(id, 102, 1)
+	b.Cancel(5)
+	assert.Equal(t, []Level{{101, 2, 1}, {102, 3, 2}, {103, 1, 1}}, b.Depth(Ask, 0))
+	assert.Equal(t, []Level{{100, 6, 1}}, b.Depth(Bid, 0))
+}
+
+func Test_DepthByOrder(t *testing.T) {
+	b := Init()
+	first, _, _ := b.Submit(Bid, 100, 5)
+	second, _, _ := b.Submit(Bid, 100, 3)
+	third, _, _ := b.Submit(Bid, 99, 1)
+
+	levels := b.DepthByOrder(Bid, 0)
+	assert.Len(t, levels, 2)
+	assert.Equal(t, Price(100), levels[0].Price)
+	assert.Equal(t, []OrderID{first, second}, []OrderID{levels[0].Orders[0].ID, levels[0].Orders[1].ID})
+	assert.Equal(t, 1, levels[0].Orders[1].Position)
+	assert.Equal(t, third, levels[1].Orders[0].ID)
+
+	info, ok := b.Order(second)
+	assert.True(t, ok)
+	assert.Equal(t, Bid, info.Side)
+	assert.Equal(t, Price(100), info.Price)
+	assert.Equal(t, Quantity(3), info.Size)
+	assert.Equal(t, 1, info.Position)
+	assert.False(t, info.Time.IsZero())
+
+	b.Cancel(first)
+	info, _ = b.Order(second)
+	assert.Equal(t, 0, info.Position)
+	_, ok = b.Order(first)
+	assert.False(t, ok)
+}
+
+func Test_Events(t *testing.T) {
+	b := testBook(Config{})
+	var events []Event
+	unsubscribe := b.Subscribe(func(e Event) { events = append(events, e) })
+
+	b.Submit(Ask, 101, 5)
+	b.Submit(Ask, 101, 2)
+	b.Submit(Bid, 101, 6)
+	assert.Equal(t, []Event{
+		{Seq: 1, Type: LevelCreated, Side: Ask, Price: 101},
+		{Seq: 2, Type: OrderAdded, Side: Ask, Price: 101, Size: 5, LevelSize: 5, OrderID: 1},
+		{Seq: 3, Type: OrderAdded, Side: Ask, Price: 101, Size: 2, LevelSize: 7, OrderID: 2},
+		{Seq: 4, Type: Trade, Side: Bid, Price: 101, Size: 5, TradeID: 1, Maker: 1, Taker: 3},
+		{Seq: 5, Type: OrderDeleted, Side: Ask, Price: 101, LevelSize: 2, OrderID: 1},
+		{Seq: 6, Type: Trade, Side: Bid, Price: 101, Size: 1, TradeID: 2, Maker: 2, Taker: 3},
+		{Seq: 7, Type: OrderReduced, Side: Ask, Price: 101, Size: 1, LevelSize: 1, OrderID: 2},
+	}, events)
+
+	events = nil
+	b.Cancel(2)
+	assert.Equal(t, []Event{
+		{Seq: 8, Type: OrderDeleted, Side: Ask, Price: 101, OrderID: 2},
+		{Seq: 9, Type: LevelRemoved, Side: Ask, Price: 101},
+	}, events)
+
+	ch := make(chan Event, 2)
+	b.SubscribeChan(ch)
+	unsubscribe()
+	events = nil
+	b.Submit(Bid, 100, 1)
+	assert.Empty(t, events)
+	assert.Equal(t, uint64(10), (<-ch).Seq)
+	assert.Equal(t, uint64(11), (<-ch).Seq)
+}
+
+func Test_Instrument(t *testing.T) {
+	b := New(Config{Instrument: Instrument{
+		TickSize: 5,
+		LotSize:  10,
+		MinSize:  10,
+		MaxSize:  100,
+		MinPrice: 50,
+		MaxPrice: 500,
+	}})
+
+	_, _, err := b.Submit(Bid, 101, 10)
+	assert.True(t, errors.Is(err, ErrOffTick))
+	_, _, err = b.Submit(Bid, 100, 15)
+	assert.True(t, errors.Is(err, ErrOffLot))
+	_, _, err = b.Submit(Bid, 45, 10)
+	assert.True(t, errors.Is(err, ErrPriceOutOfRange))
+	_, _, err = b.Submit(Bid, 100, 110)
+	assert.True(t, errors.Is(err, ErrSizeOutOfRange))
+	_, _, err = b.SubmitOrder(Order{Side: Bid, Type: Market, Size: 5})
+	assert.True(t, errors.Is(err, ErrOffLot))
+
+	id, _, err := b.Submit(Ask, 100, 20)
+	assert.NoError(t, err)
+	_, err = b.Amend(id, 102, 20)
+	assert.True(t, errors.Is(err, ErrOffTick))
+
+	// Post-only orders slide a whole tick.
+	_, execs, err := b.SubmitOrder(Order{Side: Bid, Price: 110, Size: 10, PostOnly: PostOnlySlide})
+	assert.NoError(t, err)
+	assert.Equal(t, Price(95), execs[0].Price)
+	// Prices the book works out stay inside the band.
+	b = New(Config{Instrument: Instrument{TickSize: 5, MinPrice: 50, MaxPrice: 500}})
+	b.Submit(Ask, 50, 1)
+	_, execs, _ = b.SubmitOrder(Order{Side: Bid, Price: 55, Size: 1, PostOnly: PostOnlySlide})
+	assert.Equal(t, Rejected, execs[0].Type)
+	b = New(Config{Instrument: Instrument{TickSize: 5, MinPrice: 50, MaxPrice: 500}})
+	b.Submit(Ask, 480, 1)
+	b.Submit(Bid, 480, 1)
+	stop, _, _ := b.SubmitOrder(Order{Side: Ask, Type: StopLimit, Price: 495, Size: 1, Trailing: Trailing{Offset: 10}})
+	b.Submit(Ask, 490, 1)
+	b.Submit(Bid, 490, 1)
+	assert.Equal(t, Price(470), b.stopMap[stop].price)
+	assert.Equal(t, Price(495), b.stopMap[stop].stop.Price)
+}
+
+func Test_Errors(t *testing.T) {
+	b := Init()
+	_, _, err := b.Submit(Bid, 0, 5)
+	assert.True(t, errors.Is(err, ErrInvalidPrice))
+	_, _, err = b.SubmitOrder(Order{Side: Bid, Type: Market})
+	assert.True(t, errors.Is(err, ErrInvalidSize))
+	_, _, err = b.SubmitOrder(Order{Side: Bid, Price: 100, Size: 1, TimeInForce: 9})
+	assert.True(t, errors.Is(err, ErrInvalidTimeInForce))
+
+	b.SubmitOrder(Order{ID: 7, Side: Bid, Price: 100, Size: 1})
+	_, _, err = b.SubmitOrder(Order{ID: 7, Side: Ask, Price: 101, Size: 2})
+	var oe *OrderError
+	assert.True(t, errors.As(err, &oe))
+	assert.Equal(t, ErrDuplicateOrderID, oe.Err)
+	assert.Equal(t, "submit", oe.Op)
+	assert.Equal(t, Quantity(2), oe.Order.Size)
+	assert.Equal(t, "submit order 7: order id already in use", err.Error())
+
+	_, err = b.Amend(8, 100, 1)
+	assert.True(t, errors.Is(err, ErrUnknownOrder))
+	_, err = b.Cancel(8)
+	assert.True(t, errors.As(err, &oe))
+	assert.Equal(t, &OrderError{Op: "cancel", ID: 8, Err: ErrUnknownOrder}, oe)
+}
@@ -0,0 +1,90 @@
+package orderbook
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Price is a fixed-point price, a whole number of units of 10^-scale where
+// scale is the PriceScale of the book's instrument. A price of 10125 with a
+// scale of 2 is 101.25.
+type Price uint
+
+// Quantity is a fixed-point order size, a whole number of units of 10^-scale
+// where scale is the SizeScale of the book's instrument.
+type Quantity uint
+
+// ErrInvalidDecimal is returned for strings that are not a decimal number
+// that can be represented exactly at the requested scale.
+var ErrInvalidDecimal = errors.New("invalid decimal")
+
+// ParsePrice parses a decimal string such as "101.25" into a price with
+// scale decimal places. The value must be representable exactly.
+func ParsePrice(s string, scale uint8) (Price, error) {
+	v, err := parseFixed(s, scale)
+	return Price(v), err
+}
+
+// ParseQuantity parses a decimal string such as "0.015" into a quantity with
+// scale decimal places. The value must be representable exactly.
+func ParseQuantity(s string, scale uint8) (Quantity, error) {
+	v, err := parseFixed(s, scale)
+	return Quantity(v), err
+}
+
+// Format formats the price as a decimal with scale decimal places.
+func (p Price) Format(scale uint8) string {
+	return formatFixed(uint(p), scale)
+}
+
+// Format formats the quantity as a decimal with scale decimal places.
+func (q Quantity) Format(scale uint8) string {
+	return formatFixed(uint(q), scale)
+}
+
+// parseFixed parses an unsigned decimal into an integer of units of 10^-scale.
+// Digits past scale decimal places are only accepted if they are zeros.
+func parseFixed(s string, scale uint8) (uint, error) {
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+	}
+	if whole == "" && frac == "" {
+		return 0, ErrInvalidDecimal
+	}
+	if len(frac) > int(scale) {
+		if strings.TrimRight(frac[scale:], "0") != "" {
+			return 0, ErrInvalidDecimal
+		}
+		frac = frac[:scale]
+	}
+	frac += strings.Repeat("0", int(scale)-len(frac))
+	digits := whole + frac
+	if digits == "" {
+		return 0, nil
+	}
+	for i := 0; i < len(digits); i++ {
+		if digits[i] < '0' || digits[i] > '9' {
+			return 0, ErrInvalidDecimal
+		}
+	}
+	v, err := strconv.ParseUint(digits, 10, strconv.IntSize)
+	if err != nil {
+		return 0, ErrInvalidDecimal
+	}
+	return uint(v), nil
+}
+
+// formatFixed formats an integer of units of 10^-scale as a decimal.
+func formatFixed(v uint, scale uint8) string {
+	s := strconv.FormatUint(uint64(v), 10)
+	if scale == 0 {
+		return s
+	}
+	if len(s) <= int(scale) {
+		s = strings.Repeat("0", int(scale)-len(s)+1) + s
+	}
+	i := len(s) - int(scale)
+	return s[:i] + "." + s[i:]
+}
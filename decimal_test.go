@@ -0,0 +1,43 @@
+package orderbook
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Decimal(t *testing.T) {
+	for _, c := range []struct {
+		in    string
+		scale uint8
+		want  uint
+		out   string
+	}{
+		{"101.25", 2, 10125, "101.25"},
+		{"101.2", 2, 10120, "101.20"},
+		{"101", 2, 10100, "101.00"},
+		{".5", 3, 500, "0.500"},
+		{"0.015", 8, 1500000, "0.01500000"},
+		{"1.2500", 2, 125, "1.25"},
+		{"42", 0, 42, "42"},
+	} {
+		p, err := ParsePrice(c.in, c.scale)
+		assert.NoError(t, err, c.in)
+		assert.Equal(t, Price(c.want), p, c.in)
+		assert.Equal(t, c.out, p.Format(c.scale), c.in)
+	}
+
+	for _, in := range []string{"", ".", "1.255", "-1", "1e3", "1.2.3", "99999999999999999999999"} {
+		_, err := ParseQuantity(in, 2)
+		assert.Equal(t, ErrInvalidDecimal, err, in)
+	}
+
+	i := Instrument{PriceScale: 2, SizeScale: 4}
+	b := New(Config{Instrument: i})
+	price, _ := i.ParsePrice("99.95")
+	size, _ := i.ParseQuantity("0.0015")
+	b.Submit(Bid, price, size)
+	level := b.Depth(Bid, 1)[0]
+	assert.Equal(t, "99.95", i.FormatPrice(level.Price))
+	assert.Equal(t, "0.0015", i.FormatQuantity(level.Size))
+}
@@ -0,0 +1,75 @@
+package orderbook
+
+// Level is the aggregated state of a single price limit.
+type Level struct {
+	Price  Price
+	Size   Quantity
+	Orders int
+}
+
+// Depth returns the n best price levels on the given side of the book, best
+// price first. If n is zero or negative, every level on that side is returned.
+func (b *Book) Depth(side Side, n int) []Level {
+	levels := []Level{}
+	for lim := b.best(side); lim != nil && (n <= 0 || len(levels) < n); lim = next(side, lim) {
+		levels = append(levels, level(lim))
+	}
+	return levels
+}
+
+// DepthTo returns the price levels on the given side of the book, best price
+// first, from the top of the book up to and including price. That is every bid
+// at or above price, or every ask at or below it.
+func (b *Book) DepthTo(side Side, price Price) []Level {
+	levels := []Level{}
+	for lim := b.best(side); lim != nil && crosses(!side, price, lim.price); lim = next(side, lim) {
+		levels = append(levels, level(lim))
+	}
+	return levels
+}
+
+// LevelOrders is a single price limit with its orders in queue order.
+type LevelOrders struct {
+	Price  Price
+	Orders []OrderInfo
+}
+
+// DepthByOrder returns the n best price levels on the given side of the book,
+// best price first, with every order resting at each level. If n is zero or
+// negative, every level on that side is returned. Iceberg orders only show
+// their current clip.
+func (b *Book) DepthByOrder(side Side, n int) []LevelOrders {
+	levels := []LevelOrders{}
+	for lim := b.best(side); lim != nil && (n <= 0 || len(levels) < n); lim = next(side, lim) {
+		l := LevelOrders{Price: lim.price, Orders: make([]OrderInfo, 0, lim.orders.Size())}
+		for o := lim.orders.first; o != nil; o = o.next {
+			info := o.info(len(l.Orders))
+			info.Hidden = 0
+			l.Orders = append(l.Orders, info)
+		}
+		levels = append(levels, l)
+	}
+	return levels
+}
+
+// Order returns the state of a resting order. It is false if
+// no order with that id is resting in the book.
+func (b *Book) Order(id OrderID) (OrderInfo, bool) {
+	o, ok := b.orderMap[id]
+	if !ok {
+		return OrderInfo{}, false
+	}
+	position := 0
+	for p := o.prev; p != nil; p = p.prev {
+		position++
+	}
+	return o.info(position), true
+}
+
+func level(lim *limitPrice) Level {
+	return Level{
+		Price:  lim.price,
+		Size:   lim.orders.volume,
+		Orders: lim.orders.Size(),
+	}
+}
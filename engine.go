@@ -0,0 +1,324 @@
+package orderbook
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrEngineClosed is returned for commands sent to a closed engine.
+	ErrEngineClosed = errors.New("engine is closed")
+	// ErrQueueFull is returned for commands sent to a non-blocking engine
+	// whose command queue is full.
+	ErrQueueFull = errors.New("engine command queue is full")
+)
+
+// EngineConfig is the configuration of an engine.
+type EngineConfig struct {
+	// Queue is the number of commands that can wait to be applied.
+	// Defaults to 1024.
+	Queue int
+	// Events is the number of events kept in the engine's ring buffer.
+	// Defaults to 65536.
+	Events int
+	// NoEvents leaves the engine without a ring buffer, for books whose
+	// events are read through listeners, if at all.
+	NoEvents bool
+	// NonBlocking makes commands fail with ErrQueueFull when the queue
+	// is full, instead of waiting for room.
+	NonBlocking bool
+}
+
+// Engine owns a book and applies commands to it one at a time on a single
+// goroutine, in the order they were queued. Commands return a Future for their
+// result, and the book's events are published to a ring buffer.
+//
+// Commands wait for room in the queue when it is full, unless the engine is
+// non-blocking, so a busy engine pushes back on its callers.
+type Engine struct {
+	book     *Book
+	commands chan command
+	events   *Ring
+	nonblock bool
+
+	mu     sync.RWMutex
+	closed bool
+	done   chan struct{}
+}
+
+// Result is the result of a command.
+type Result struct {
+	OrderID    OrderID
+	Executions []Execution
+	Err        error
+}
+
+// Future is the result of a command that may not have been applied yet.
+type Future struct {
+	done   chan struct{}
+	result Result
+}
+
+// Done is closed once the command has been applied.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait waits for the command to be applied and returns its result.
+func (f *Future) Wait() Result {
+	<-f.done
+	return f.result
+}
+
+func (f *Future) resolve(r Result) {
+	f.result = r
+	close(f.done)
+}
+
+func newFuture() *Future {
+	return &Future{done: make(chan struct{})}
+}
+
+type commandKind int
+
+const (
+	commandSubmit commandKind = iota
+	commandAmend
+	commandCancel
+	commandCancelAll
+	commandExpire
+	commandStartAuction
+	commandUncross
+	commandQuery
+)
+
+type command struct {
+	kind    commandKind
+	orders  []Order
+	id      OrderID
+	price   Price
+	size    Quantity
+	owner   string
+	filter  CancelFilter
+	query   func(*Book)
+	futures []*Future
+}
+
+// NewEngine starts an engine that owns b. The book must not be used
+// directly afterwards.
+func NewEngine(b *Book, cfg EngineConfig) *Engine {
+	if cfg.Queue <= 0 {
+		cfg.Queue = 1024
+	}
+	if cfg.Events <= 0 {
+		cfg.Events = 65536
+	}
+	e := &Engine{
+		book:     b,
+		commands: make(chan command, cfg.Queue),
+		nonblock: cfg.NonBlocking,
+		done:     make(chan struct{}),
+	}
+	if !cfg.NoEvents {
+		e.events = NewRing(cfg.Events)
+		b.Subscribe(e.events.Write)
+	}
+	go e.run()
+	return e
+}
+
+// Events returns the ring buffer the book's events are published to,
+// nil if the engine has none.
+func (e *Engine) Events() *Ring {
+	return e.events
+}
+
+// Submit queues an order to be submitted to the book.
+func (e *Engine) Submit(o Order) (*Future, error) {
+	f := newFuture()
+	return f, e.send(command{kind: commandSubmit, orders: []Order{o}, futures: []*Future{f}})
+}
+
+// SubmitBatch queues orders to be submitted to the book one after the other,
+// taking a single place in the queue. There is one future per order.
+func (e *Engine) SubmitBatch(orders []Order) ([]*Future, error) {
+	futures := make([]*Future, len(orders))
+	for i := range futures {
+		futures[i] = newFuture()
+	}
+	return futures, e.send(command{kind: commandSubmit, orders: orders, futures: futures})
+}
+
+// Amend queues an amendment of a resting order.
+func (e *Engine) Amend(id OrderID, price Price, size Quantity) (*Future, error) {
+	f := newFuture()
+	return f, e.send(command{kind: commandAmend, id: id, price: price, size: size, futures: []*Future{f}})
+}
+
+// Cancel queues the cancellation of a resting order.
+func (e *Engine) Cancel(id OrderID) (*Future, error) {
+	f := newFuture()
+	return f, e.send(command{kind: commandCancel, id: id, futures: []*Future{f}})
+}
+
+// CancelAll queues the cancellation of an owner's resting orders.
+func (e *Engine) CancelAll(owner string, f CancelFilter) (*Future, error) {
+	future := newFuture()
+	return future, e.send(command{kind: commandCancelAll, owner: owner, filter: f, futures: []*Future{future}})
+}
+
+// Expire queues the expiry of the orders that are due.
+func (e *Engine) Expire() (*Future, error) {
+	f := newFuture()
+	return f, e.send(command{kind: commandExpire, futures: []*Future{f}})
+}
+
+// StartAuction queues the start of a call auction.
+func (e *Engine) StartAuction(reference Price) (*Future, error) {
+	f := newFuture()
+	return f, e.send(command{kind: commandStartAuction, price: reference, futures: []*Future{f}})
+}
+
+// Uncross queues the uncross that ends a call auction.
+func (e *Engine) Uncross() (*Future, error) {
+	f := newFuture()
+	return f, e.send(command{kind: commandUncross, futures: []*Future{f}})
+}
+
+// Query queues a call of f with the book, between other commands.
+// f must not keep the book after returning.
+func (e *Engine) Query(f func(*Book)) (*Future, error) {
+	future := newFuture()
+	return future, e.send(command{kind: commandQuery, query: f, futures: []*Future{future}})
+}
+
+func (e *Engine) send(c command) error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.closed {
+		return ErrEngineClosed
+	}
+	if !e.nonblock {
+		e.commands <- c
+		return nil
+	}
+	select {
+	case e.commands <- c:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Close stops the engine from taking new commands, waits for the queued ones
+// to be applied and closes the event ring buffer.
+func (e *Engine) Close() {
+	e.mu.Lock()
+	if !e.closed {
+		e.closed = true
+		close(e.commands)
+	}
+	e.mu.Unlock()
+	<-e.done
+}
+
+func (e *Engine) run() {
+	defer close(e.done)
+	if e.events != nil {
+		defer e.events.Close()
+	}
+
+	for c := range e.commands {
+		switch c.kind {
+		case commandSubmit:
+			for i, o := range c.orders {
+				id, execs, err := e.book.SubmitOrder(o)
+				c.futures[i].resolve(Result{OrderID: id, Executions: execs, Err: err})
+			}
+		case commandAmend:
+			execs, err := e.book.Amend(c.id, c.price, c.size)
+			c.futures[0].resolve(Result{OrderID: c.id, Executions: execs, Err: err})
+		case commandCancel:
+			_, err := e.book.Cancel(c.id)
+			c.futures[0].resolve(Result{OrderID: c.id, Err: err})
+		case commandCancelAll:
+			execs, err := e.book.CancelAll(c.owner, c.filter)
+			c.futures[0].resolve(Result{Executions: execs, Err: err})
+		case commandExpire:
+			execs, err := e.book.Expire()
+			c.futures[0].resolve(Result{Executions: execs, Err: err})
+		case commandStartAuction:
+			err := e.book.StartAuction(c.price)
+			c.futures[0].resolve(Result{Err: err})
+		case commandUncross:
+			execs, err := e.book.Uncross()
+			c.futures[0].resolve(Result{Executions: execs, Err: err})
+		case commandQuery:
+			c.query(e.book)
+			c.futures[0].resolve(Result{})
+		}
+	}
+}
+
+// Ring is a fixed size ring buffer of events, safe for concurrent use. When it
+// is full the oldest events are overwritten, readers that fall behind can tell
+// from the gap in sequence numbers.
+type Ring struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	buf    []Event
+	last   uint64
+	count  int
+	closed bool
+}
+
+// NewRing returns a ring buffer holding up to size events.
+func NewRing(size int) *Ring {
+	r := &Ring{buf: make([]Event, size)}
+	r.cond = sync.NewCond(&r.mu)
+	return r
+}
+
+// Write adds an event to the ring buffer. Events must be written in
+// sequence, with no gaps.
+func (r *Ring) Write(e Event) {
+	r.mu.Lock()
+	r.buf[e.Seq%uint64(len(r.buf))] = e
+	r.last = e.Seq
+	if r.count < len(r.buf) {
+		r.count++
+	}
+	r.mu.Unlock()
+	r.cond.Broadcast()
+}
+
+// Next waits for events with a sequence number above after and returns those
+// still in the buffer, oldest first. It returns false once the ring is closed
+// and every event has been read.
+func (r *Ring) Next(after uint64) ([]Event, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for r.last <= after && !r.closed {
+		r.cond.Wait()
+	}
+	if r.last <= after {
+		return nil, false
+	}
+	from := r.last - uint64(r.count) + 1
+	if from <= after {
+		from = after + 1
+	}
+	events := make([]Event, 0, r.last-from+1)
+	for seq := from; seq <= r.last; seq++ {
+		events = append(events, r.buf[seq%uint64(len(r.buf))])
+	}
+	return events, true
+}
+
+// Close wakes up waiting readers, after which Next no longer waits.
+func (r *Ring) Close() {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+	r.cond.Broadcast()
+}
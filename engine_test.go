@@ -0,0 +1,79 @@
+package orderbook
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Engine(t *testing.T) {
+	e := NewEngine(Init(), EngineConfig{Queue: 4, Events: 8})
+
+	var (
+		wg     sync.WaitGroup
+		events []Event
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		var seq uint64
+		for {
+			evs, ok := e.Events().Next(seq)
+			if !ok {
+				return
+			}
+			events = append(events, evs...)
+			seq = evs[len(evs)-1].Seq
+		}
+	}()
+
+	futures, err := e.SubmitBatch([]Order{
+		{Side: Ask, Price: 101, Size: 5},
+		{Side: Ask, Price: 102, Size: 5},
+	})
+	assert.NoError(t, err)
+	f, _ := e.Submit(Order{Side: Bid, Price: 101, Size: 2})
+	r := f.Wait()
+	assert.NoError(t, r.Err)
+	assert.Len(t, r.Executions, 2)
+	assert.Equal(t, OrderID(1), futures[0].Wait().OrderID)
+
+	f, _ = e.Amend(2, 102, 1)
+	assert.NoError(t, f.Wait().Err)
+	f, _ = e.Cancel(99)
+	assert.Error(t, f.Wait().Err)
+
+	var bid, ask Price
+	f, _ = e.Query(func(b *Book) { bid, ask = b.Top() })
+	f.Wait()
+	assert.Equal(t, Price(0), bid)
+	assert.Equal(t, Price(101), ask)
+
+	// Closing drains whatever is still queued.
+	for i := 0; i < 10; i++ {
+		e.Submit(Order{Side: Bid, Price: 90, Size: 1})
+	}
+	e.Close()
+	_, err = e.Submit(Order{Side: Bid, Price: 90, Size: 1})
+	assert.Equal(t, ErrEngineClosed, err)
+	wg.Wait()
+
+	assert.Len(t, e.book.orderMap, 12)
+	assert.Equal(t, e.book.seq, events[len(events)-1].Seq)
+}
+
+func Test_EngineNonBlocking(t *testing.T) {
+	e := NewEngine(Init(), EngineConfig{Queue: 1, NonBlocking: true})
+	defer e.Close()
+
+	// Hold up the engine so the queue fills.
+	hold := make(chan struct{})
+	e.Query(func(*Book) { <-hold })
+	var err error
+	for i := 0; i < 3 && err == nil; i++ {
+		_, err = e.Submit(Order{Side: Bid, Price: 90, Size: 1})
+	}
+	assert.Equal(t, ErrQueueFull, err)
+	close(hold)
+}
@@ -0,0 +1,75 @@
+package orderbook
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Reasons the book rejects a command. The book returns an *OrderError wrapping
+// one of these, one of the instrument errors such as ErrOffTick, or the error
+// writing to its journal, so they can be told apart with errors.Is.
+var (
+	// ErrInvalidPrice is returned for limit prices of zero.
+	ErrInvalidPrice = errors.New("invalid price")
+	// ErrInvalidSize is returned for sizes of zero.
+	ErrInvalidSize = errors.New("invalid size")
+	// ErrInvalidOrderType is returned for unknown order types.
+	ErrInvalidOrderType = errors.New("invalid order type")
+	// ErrInvalidTimeInForce is returned for unknown times in force.
+	ErrInvalidTimeInForce = errors.New("invalid time in force")
+	// ErrInvalidExpireTime is returned for good till date orders that do not
+	// expire after they are submitted, and for other orders with an expire time.
+	ErrInvalidExpireTime = errors.New("invalid expire time")
+	// ErrInvalidPostOnly is returned for post-only orders that are not
+	// limit orders that rest in the book.
+	ErrInvalidPostOnly = errors.New("post-only orders must be resting limit orders")
+	// ErrInvalidDisplaySize is returned for iceberg orders that are not
+	// limit orders that rest in the book.
+	ErrInvalidDisplaySize = errors.New("iceberg orders must be resting limit orders")
+	// ErrInvalidStopPrice is returned for stop orders without a stop price,
+	// and for other orders with one.
+	ErrInvalidStopPrice = errors.New("invalid stop price")
+	// ErrInvalidTrailingStop is returned for trailing stops that are not stop
+	// orders, that have a stop price, or either both or neither of an offset
+	// and basis points, for trailing stops submitted before the first trade,
+	// and for those that would start at the last trade price or, selling, at
+	// or below zero.
+	ErrInvalidTrailingStop = errors.New("invalid trailing stop")
+	// ErrAuction is returned for orders a book in an auction does not accept,
+	// market, immediate or cancel, fill or kill and post-only orders, and for
+	// starting an auction in a book that is already in one.
+	ErrAuction = errors.New("not allowed during an auction")
+	// ErrNoAuction is returned for uncrossing a book that is not in an auction.
+	ErrNoAuction = errors.New("book is not in an auction")
+	// ErrDuplicateOrderID is returned for caller supplied order ids
+	// that belong to a live order.
+	ErrDuplicateOrderID = errors.New("order id already in use")
+	// ErrUnknownOrder is returned for order ids that are not resting in the book.
+	ErrUnknownOrder = errors.New("order does not exist")
+)
+
+// OrderError is the error returned when the book rejects a command. It wraps
+// the reason for the rejection and carries the details of the command.
+type OrderError struct {
+	// Op is the rejected command, "submit", "amend", "cancel", "cancel all",
+	// "expire", "start auction" or "uncross".
+	Op string
+	// ID is the order the command was for, if it had one.
+	ID OrderID
+	// Order is the submitted order, or the new price and size of an amendment.
+	Order Order
+	// Err is the reason for the rejection.
+	Err error
+}
+
+func (e *OrderError) Error() string {
+	if e.ID == 0 {
+		return fmt.Sprintf("%s: %v", e.Op, e.Err)
+	}
+	return fmt.Sprintf("%s order %d: %v", e.Op, e.ID, e.Err)
+}
+
+// Unwrap returns the reason for the rejection.
+func (e *OrderError) Unwrap() error {
+	return e.Err
+}
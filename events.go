@@ -0,0 +1,111 @@
+package orderbook
+
+import "time"
+
+// EventType is the kind of a market data event.
+type EventType int
+
+const (
+	// OrderAdded means an order started resting in the book.
+	OrderAdded EventType = iota + 1
+	// OrderReduced means the open size of a resting order went down,
+	// but the order is still resting.
+	OrderReduced
+	// OrderDeleted means a resting order left the book, filled or cancelled.
+	OrderDeleted
+	// Trade means two orders matched.
+	Trade
+	// LevelCreated means the first order arrived at a new price limit.
+	LevelCreated
+	// LevelRemoved means the last order left a price limit.
+	LevelRemoved
+)
+
+// Event is a single change to the state of the book.
+//
+// Order and level events describe the order or price limit that changed. Trade
+// events carry the trade id, price and quantity, with Side being the side of
+// the taker.
+type Event struct {
+	// Seq numbers the book's events, starting at 1 and increasing by one
+	// with every event, so consumers can detect gaps.
+	Seq  uint64
+	Type EventType
+	// Time is when the book applied the command that caused the event.
+	Time time.Time
+
+	Side  Side
+	Price Price
+	// Size is the open size of the order after the change, or the
+	// quantity of a trade.
+	Size Quantity
+	// LevelSize is the total size resting at Price after the change.
+	LevelSize Quantity
+
+	// OrderID is the order that changed.
+	OrderID OrderID
+
+	// TradeID, Maker and Taker identify a trade and the resting and
+	// incoming orders that made it.
+	TradeID uint64
+	Maker   OrderID
+	Taker   OrderID
+}
+
+// Listener receives the events of a book. Listeners are called synchronously
+// as the book changes, so they must not call back into the book.
+type Listener func(Event)
+
+// Subscribe registers a listener for every event of the book from now on.
+// The returned function unregisters it.
+func (b *Book) Subscribe(l Listener) (unsubscribe func()) {
+	b.listeners = append(b.listeners, l)
+	i := len(b.listeners) - 1
+	return func() {
+		b.listeners[i] = nil
+	}
+}
+
+// SubscribeChan sends every event of the book from now on to ch. Sends block,
+// so a slow reader holds up the book. The returned function unsubscribes.
+func (b *Book) SubscribeChan(ch chan<- Event) (unsubscribe func()) {
+	return b.Subscribe(func(e Event) { ch <- e })
+}
+
+// emit sequences an event and hands it to the listeners.
+func (b *Book) emit(e Event) {
+	b.seq++
+	e.Seq = b.seq
+	e.Time = b.at
+	for _, l := range b.listeners {
+		if l != nil {
+			l(e)
+		}
+	}
+}
+
+// emitOrder emits an event about a resting order.
+func (b *Book) emitOrder(typ EventType, o *order, lim *limitPrice) {
+	size := o.size
+	if typ == OrderDeleted {
+		size = 0
+	}
+	b.emit(Event{
+		Type:      typ,
+		Side:      o.side,
+		Price:     o.price,
+		Size:      size,
+		LevelSize: lim.orders.volume,
+		OrderID:   o.id,
+	})
+}
+
+// emitLevel emits an event about a price limit.
+func (b *Book) emitLevel(typ EventType, side Side, lim *limitPrice) {
+	b.emit(Event{
+		Type:      typ,
+		Side:      side,
+		Price:     lim.price,
+		LevelSize: lim.orders.volume,
+	})
+}
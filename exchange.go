@@ -0,0 +1,327 @@
+package orderbook
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+var (
+	// ErrSymbolExists is returned when listing a symbol twice.
+	ErrSymbolExists = errors.New("symbol is already listed")
+	// ErrUnknownSymbol is returned for symbols that are not listed.
+	ErrUnknownSymbol = errors.New("symbol is not listed")
+)
+
+// ExchangeConfig is the configuration of an exchange.
+type ExchangeConfig struct {
+	// Parallel gives every book its own Engine, so commands for different
+	// symbols are applied in parallel. Otherwise commands are applied on the
+	// caller's goroutine, holding a lock on the book.
+	Parallel bool
+	// Engine configures the engines of a parallel exchange. They keep no
+	// ring buffer of events, subscribe to a Listing to receive them.
+	Engine EngineConfig
+}
+
+// Exchange manages the order books of many instruments, keyed by symbol.
+// It is safe for concurrent use.
+type Exchange struct {
+	cfg ExchangeConfig
+
+	mu       sync.RWMutex
+	listings map[string]*Listing
+}
+
+// Listing is a book listed on an exchange. Its commands return futures in
+// either kind of exchange; on an exchange that isn't parallel they are
+// already resolved. Once the book is removed from the exchange, its commands
+// return ErrUnknownSymbol.
+type Listing struct {
+	Symbol string
+	Config Config
+
+	book   *SafeBook
+	engine *Engine
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewExchange returns an exchange with no books.
+func NewExchange(cfg ExchangeConfig) *Exchange {
+	return &Exchange{cfg: cfg, listings: make(map[string]*Listing)}
+}
+
+// Create lists a new book for symbol, configured with cfg.
+func (x *Exchange) Create(symbol string, cfg Config) (*Listing, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if _, ok := x.listings[symbol]; ok {
+		return nil, ErrSymbolExists
+	}
+	m := &Listing{Symbol: symbol, Config: cfg}
+	if x.cfg.Parallel {
+		engine := x.cfg.Engine
+		engine.NoEvents = true
+		m.engine = NewEngine(New(cfg), engine)
+	} else {
+		m.book = NewSafeBook(New(cfg))
+	}
+	x.listings[symbol] = m
+	return m, nil
+}
+
+// Listing looks up the book listed for symbol.
+func (x *Exchange) Listing(symbol string) (*Listing, bool) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	m, ok := x.listings[symbol]
+	return m, ok
+}
+
+// Symbols returns the listed symbols in order.
+func (x *Exchange) Symbols() []string {
+	x.mu.RLock()
+	symbols := make([]string, 0, len(x.listings))
+	for s := range x.listings {
+		symbols = append(symbols, s)
+	}
+	x.mu.RUnlock()
+	sort.Strings(symbols)
+	return symbols
+}
+
+// Remove delists the book for symbol. Commands already queued for it are
+// applied first.
+func (x *Exchange) Remove(symbol string) error {
+	x.mu.Lock()
+	m, ok := x.listings[symbol]
+	delete(x.listings, symbol)
+	x.mu.Unlock()
+	if !ok {
+		return ErrUnknownSymbol
+	}
+	m.close()
+	return nil
+}
+
+// Close delists every book.
+func (x *Exchange) Close() {
+	for _, s := range x.Symbols() {
+		x.Remove(s)
+	}
+}
+
+// Submit routes an order to the book for symbol.
+func (x *Exchange) Submit(symbol string, o Order) (*Future, error) {
+	m, ok := x.Listing(symbol)
+	if !ok {
+		return nil, ErrUnknownSymbol
+	}
+	return m.Submit(o)
+}
+
+// Amend routes an amendment to the book for symbol.
+func (x *Exchange) Amend(symbol string, id OrderID, price Price, size Quantity) (*Future, error) {
+	m, ok := x.Listing(symbol)
+	if !ok {
+		return nil, ErrUnknownSymbol
+	}
+	return m.Amend(id, price, size)
+}
+
+// Cancel routes a cancellation to the book for symbol.
+func (x *Exchange) Cancel(symbol string, id OrderID) (*Future, error) {
+	m, ok := x.Listing(symbol)
+	if !ok {
+		return nil, ErrUnknownSymbol
+	}
+	return m.Cancel(id)
+}
+
+// CancelAll routes the cancellation of an owner's orders to the book for symbol.
+func (x *Exchange) CancelAll(symbol, owner string, f CancelFilter) (*Future, error) {
+	m, ok := x.Listing(symbol)
+	if !ok {
+		return nil, ErrUnknownSymbol
+	}
+	return m.CancelAll(owner, f)
+}
+
+// Expire expires the orders that are due in the book for symbol.
+func (x *Exchange) Expire(symbol string) (*Future, error) {
+	m, ok := x.Listing(symbol)
+	if !ok {
+		return nil, ErrUnknownSymbol
+	}
+	return m.Expire()
+}
+
+// StartAuction starts a call auction in the book for symbol.
+func (x *Exchange) StartAuction(symbol string, reference Price) (*Future, error) {
+	m, ok := x.Listing(symbol)
+	if !ok {
+		return nil, ErrUnknownSymbol
+	}
+	return m.StartAuction(reference)
+}
+
+// Uncross ends the call auction in the book for symbol.
+func (x *Exchange) Uncross(symbol string) (*Future, error) {
+	m, ok := x.Listing(symbol)
+	if !ok {
+		return nil, ErrUnknownSymbol
+	}
+	return m.Uncross()
+}
+
+// Query calls f with the book for symbol.
+func (x *Exchange) Query(symbol string, f func(*Book)) (*Future, error) {
+	m, ok := x.Listing(symbol)
+	if !ok {
+		return nil, ErrUnknownSymbol
+	}
+	return m.Query(f)
+}
+
+// Submit submits an order to the book.
+func (m *Listing) Submit(o Order) (*Future, error) {
+	if err := m.use(); err != nil {
+		return nil, err
+	}
+	defer m.mu.RUnlock()
+	if m.engine != nil {
+		return m.engine.Submit(o)
+	}
+	id, execs, err := m.book.SubmitOrder(o)
+	return resolved(Result{OrderID: id, Executions: execs, Err: err}), nil
+}
+
+// Amend amends a resting order.
+func (m *Listing) Amend(id OrderID, price Price, size Quantity) (*Future, error) {
+	if err := m.use(); err != nil {
+		return nil, err
+	}
+	defer m.mu.RUnlock()
+	if m.engine != nil {
+		return m.engine.Amend(id, price, size)
+	}
+	execs, err := m.book.Amend(id, price, size)
+	return resolved(Result{OrderID: id, Executions: execs, Err: err}), nil
+}
+
+// Cancel cancels a resting order.
+func (m *Listing) Cancel(id OrderID) (*Future, error) {
+	if err := m.use(); err != nil {
+		return nil, err
+	}
+	defer m.mu.RUnlock()
+	if m.engine != nil {
+		return m.engine.Cancel(id)
+	}
+	_, err := m.book.Cancel(id)
+	return resolved(Result{OrderID: id, Err: err}), nil
+}
+
+// CancelAll cancels the resting orders of an owner.
+func (m *Listing) CancelAll(owner string, f CancelFilter) (*Future, error) {
+	if err := m.use(); err != nil {
+		return nil, err
+	}
+	defer m.mu.RUnlock()
+	if m.engine != nil {
+		return m.engine.CancelAll(owner, f)
+	}
+	execs, err := m.book.CancelAll(owner, f)
+	return resolved(Result{Executions: execs, Err: err}), nil
+}
+
+// Expire expires the orders that are due.
+func (m *Listing) Expire() (*Future, error) {
+	if err := m.use(); err != nil {
+		return nil, err
+	}
+	defer m.mu.RUnlock()
+	if m.engine != nil {
+		return m.engine.Expire()
+	}
+	execs, err := m.book.Expire()
+	return resolved(Result{Executions: execs, Err: err}), nil
+}
+
+// StartAuction starts a call auction.
+func (m *Listing) StartAuction(reference Price) (*Future, error) {
+	if err := m.use(); err != nil {
+		return nil, err
+	}
+	defer m.mu.RUnlock()
+	if m.engine != nil {
+		return m.engine.StartAuction(reference)
+	}
+	err := m.book.StartAuction(reference)
+	return resolved(Result{Err: err}), nil
+}
+
+// Uncross ends the call auction.
+func (m *Listing) Uncross() (*Future, error) {
+	if err := m.use(); err != nil {
+		return nil, err
+	}
+	defer m.mu.RUnlock()
+	if m.engine != nil {
+		return m.engine.Uncross()
+	}
+	execs, err := m.book.Uncross()
+	return resolved(Result{Executions: execs, Err: err}), nil
+}
+
+// Query calls f with the book. f may change the book,
+// but must not keep it after returning.
+func (m *Listing) Query(f func(*Book)) (*Future, error) {
+	if err := m.use(); err != nil {
+		return nil, err
+	}
+	defer m.mu.RUnlock()
+	if m.engine != nil {
+		return m.engine.Query(f)
+	}
+	m.book.Update(f)
+	return resolved(Result{}), nil
+}
+
+// Subscribe registers a listener for the book's events. On a parallel
+// exchange the listener is called on the book's engine goroutine.
+func (m *Listing) Subscribe(l Listener) error {
+	f, err := m.Query(func(b *Book) { b.Subscribe(l) })
+	if err != nil {
+		return err
+	}
+	f.Wait()
+	return nil
+}
+
+// use read-locks the listing for a command, unless it has been removed.
+func (m *Listing) use() error {
+	m.mu.RLock()
+	if m.closed {
+		m.mu.RUnlock()
+		return ErrUnknownSymbol
+	}
+	return nil
+}
+
+func (m *Listing) close() {
+	m.mu.Lock()
+	m.closed = true
+	m.mu.Unlock()
+	if m.engine != nil {
+		m.engine.Close()
+	}
+}
+
+func resolved(r Result) *Future {
+	f := newFuture()
+	f.resolve(r)
+	return f
+}
@@ -0,0 +1,54 @@
+package orderbook
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Exchange(t *testing.T) {
+	for _, parallel := range []bool{false, true} {
+		x := NewExchange(ExchangeConfig{Parallel: parallel})
+		for i := 0; i < 10; i++ {
+			_, err := x.Create(fmt.Sprintf("SYM%d", i), Config{})
+			assert.NoError(t, err)
+		}
+		_, err := x.Create("SYM0", Config{})
+		assert.Equal(t, ErrSymbolExists, err)
+
+		var wg sync.WaitGroup
+		for _, s := range x.Symbols() {
+			wg.Add(1)
+			go func(s string) {
+				defer wg.Done()
+				x.Submit(s, Order{Side: Ask, Price: 101, Size: 5})
+				f, err := x.Submit(s, Order{Side: Bid, Price: 101, Size: 2})
+				assert.NoError(t, err)
+				assert.Len(t, f.Wait().Executions, 2)
+			}(s)
+		}
+		wg.Wait()
+
+		m, ok := x.Listing("SYM3")
+		assert.True(t, ok)
+		var depth []Level
+		f, _ := m.Query(func(b *Book) { depth = b.Depth(Ask, 0) })
+		f.Wait()
+		assert.Equal(t, []Level{{101, 3, 1}}, depth)
+		if parallel {
+			// Events reach listings through listeners, not ring buffers.
+			assert.Nil(t, m.engine.Events())
+		}
+
+		assert.NoError(t, x.Remove("SYM3"))
+		_, err = x.Submit("SYM3", Order{Side: Bid, Price: 101, Size: 2})
+		assert.Equal(t, ErrUnknownSymbol, err)
+		_, err = m.Submit(Order{Side: Bid, Price: 101, Size: 2})
+		assert.Equal(t, ErrUnknownSymbol, err)
+		assert.Len(t, x.Symbols(), 9)
+		x.Close()
+		assert.Empty(t, x.Symbols())
+	}
+}
@@ -1,8 +1,76 @@
 package orderbook
 
+import "time"
+
+// ExecType is the kind of an execution report.
+type ExecType int
+
+const (
+	// Filled means the order was matched, in whole or in part.
+	Filled ExecType = iota
+	// Cancelled means quantity of the order was cancelled by the book.
+	Cancelled
+	// Rejected means the order was refused and never entered the book.
+	Rejected
+	// Repriced means the order rests in the book at a different price than submitted.
+	Repriced
+	// Replaced means the order's price or size was amended.
+	Replaced
+	// SelfTradePrevented means quantity of the order was cancelled so it
+	// would not trade with another order of the same owner, the Counterparty.
+	SelfTradePrevented
+	// Triggered means a stop order was triggered and submitted to the book,
+	// Price is the trade price that triggered it.
+	Triggered
+	// Expired means a good till date or day order expired.
+	Expired
+)
+
+// Liquidity tells whether a fill added liquidity to the book or took it.
+// Fills of an auction uncross do neither, their Liquidity is zero.
+type Liquidity int
+
+const (
+	// LiquidityAdded fills belong to the resting order of a trade, the maker.
+	LiquidityAdded Liquidity = iota + 1
+	// LiquidityRemoved fills belong to the incoming order of a trade, the taker.
+	LiquidityRemoved
+)
+
 // Execution is an execution report.
 type Execution struct {
 	OrderID           OrderID
-	FilledQuantity    uint
-	RemainingQuantity uint
+	Type              ExecType
+	Side              Side
+	FilledQuantity    Quantity
+	RemainingQuantity Quantity
+	CancelledQuantity Quantity
+	// HiddenQuantity is the part of RemainingQuantity an iceberg order
+	// holds in reserve, out of sight of the market.
+	HiddenQuantity Quantity
+
+	// Price is the price of a fill, which is always the resting order's price,
+	// or the price a Repriced or Replaced order rests at.
+	Price Price
+
+	// TradeID identifies the trade a fill belongs to, the maker's and the
+	// taker's fills of a trade share it. Trade ids start at 1 and increase by
+	// one with every trade in the book, so they also sequence the trades.
+	TradeID uint64
+	// Counterparty is the order on the other side of the trade.
+	Counterparty OrderID
+	// Liquidity tells whether the fill was the maker or the taker side.
+	Liquidity Liquidity
+
+	// Time is when the book applied the command that produced the report,
+	// the match time of a fill.
+	Time time.Time
+}
+
+// stamp sets the time of a command's executions.
+func stamp(execs []Execution, now time.Time) []Execution {
+	for i := range execs {
+		execs[i].Time = now
+	}
+	return execs
 }
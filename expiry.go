@@ -0,0 +1,107 @@
+package orderbook
+
+import (
+	"container/heap"
+	"time"
+)
+
+// expiries is a heap of the orders that expire, resting or waiting to be
+// triggered, the one that expires first on top.
+type expiries []*order
+
+func (h expiries) Len() int { return len(h) }
+
+func (h expiries) Less(i, j int) bool {
+	if !h[i].expires.Equal(h[j].expires) {
+		return h[i].expires.Before(h[j].expires)
+	}
+	// Orders expiring at the same time expire in id order.
+	return h[i].id < h[j].id
+}
+
+func (h expiries) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].expiry = i
+	h[j].expiry = j
+}
+
+func (h *expiries) Push(x interface{}) {
+	o := x.(*order)
+	o.expiry = len(*h)
+	*h = append(*h, o)
+}
+
+func (h *expiries) Pop() interface{} {
+	old := *h
+	o := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return o
+}
+
+// schedule adds an order that expires to the expiry queue.
+func (b *Book) schedule(o *order) {
+	if !o.expires.IsZero() {
+		heap.Push(&b.expiries, o)
+	}
+}
+
+// unschedule takes an order out of the expiry queue.
+func (b *Book) unschedule(o *order) {
+	if !o.expires.IsZero() {
+		heap.Remove(&b.expiries, o.expiry)
+	}
+}
+
+// expiry returns when an order submitted at now expires, or the zero time if
+// it does not.
+func (b *Book) expiry(o Order, now time.Time) time.Time {
+	switch o.TimeInForce {
+	case GoodTillDate:
+		return o.ExpireTime
+	case Day:
+		return b.sessionEnd(now)
+	}
+	return time.Time{}
+}
+
+// Expire removes every order that has expired by the time of the book's clock,
+// resting or waiting to be triggered, and returns an Expired report for each,
+// soonest expiry first. The book also expires orders before every submission
+// and amendment, so expired orders never trade, but until Expire is called or
+// the next command arrives they remain in the book.
+func (b *Book) Expire() ([]Execution, error) {
+	now := b.now()
+	if err := b.journal.expire(now); err != nil {
+		return nil, &OrderError{Op: "expire", Err: err}
+	}
+	return b.expire(now), nil
+}
+
+// expire removes the orders that have expired by now.
+func (b *Book) expire(now time.Time) []Execution {
+	var execs []Execution
+	b.at = now
+	for len(b.expiries) > 0 && !b.expiries[0].expires.After(now) {
+		o := b.expiries[0]
+		execs = append(execs, Execution{
+			OrderID:           o.id,
+			Type:              Expired,
+			Side:              o.side,
+			CancelledQuantity: o.size + o.hidden,
+			Price:             o.price,
+		})
+		if o.stop != nil {
+			b.release(o)
+		} else {
+			b.cancel(o, b.limit(o))
+		}
+	}
+	return stamp(execs, now)
+}
+
+// endOfDay returns the midnight following t, in t's location.
+func endOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,18 @@
+package orderbook
+
+import "time"
+
+// replenish refills the clip of an iceberg order whose shown size was just
+// filled from its reserve, and sends it to the back of the queue at lim,
+// as if it had been submitted at time now.
+func (b *Book) replenish(o *order, lim *limitPrice, now time.Time) {
+	clip := o.display
+	if clip > o.hidden {
+		clip = o.hidden
+	}
+	o.hidden -= clip
+	o.size = clip
+	o.time = now
+	lim.orders.add(o)
+	b.emitOrder(OrderAdded, o, lim)
+}
@@ -0,0 +1,90 @@
+package orderbook
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/rand"
+)
+
+// IDGenerator generates ids for new orders. The book skips any id that
+// belongs to an order that is still live, so generators need not track
+// which ids are in use, but they must never return zero.
+type IDGenerator interface {
+	NextID() OrderID
+}
+
+// Sequence generates monotonically increasing order ids.
+// The zero value starts at 1.
+type Sequence struct {
+	last OrderID
+}
+
+// NewSequence returns a sequence whose first id is start.
+func NewSequence(start OrderID) *Sequence {
+	return &Sequence{last: start - 1}
+}
+
+// NextID returns the next id in the sequence.
+func (s *Sequence) NextID() OrderID {
+	s.last++
+	if s.last == 0 {
+		s.last++
+	}
+	return s.last
+}
+
+// RandomIDs generates psuedo-random 8-digit order ids.
+// The same seed always generates the same ids.
+type RandomIDs struct {
+	seed int64
+	n    uint64
+	r    *rand.Rand
+}
+
+// NewRandomIDs returns a generator of psuedo-random ids seeded with seed.
+func NewRandomIDs(seed int64) *RandomIDs {
+	return &RandomIDs{seed: seed, r: rand.New(rand.NewSource(seed))}
+}
+
+// NextID returns the next psuedo-random id.
+func (g *RandomIDs) NextID() OrderID {
+	g.n++
+	return OrderID(10000000 + g.r.Intn(99999999-10000000))
+}
+
+// MarshalBinary encodes the position of the sequence.
+func (s *Sequence) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(s.last))
+	return b, nil
+}
+
+// UnmarshalBinary restores the position of the sequence.
+func (s *Sequence) UnmarshalBinary(b []byte) error {
+	if len(b) != 8 {
+		return errors.New("invalid sequence state")
+	}
+	s.last = OrderID(binary.LittleEndian.Uint64(b))
+	return nil
+}
+
+// MarshalBinary encodes the seed of the generator and how many ids it has generated.
+func (g *RandomIDs) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 16)
+	binary.LittleEndian.PutUint64(b, uint64(g.seed))
+	binary.LittleEndian.PutUint64(b[8:], g.n)
+	return b, nil
+}
+
+// UnmarshalBinary restores the generator, drawing the ids it had
+// already generated again.
+func (g *RandomIDs) UnmarshalBinary(b []byte) error {
+	if len(b) != 16 {
+		return errors.New("invalid random id state")
+	}
+	*g = *NewRandomIDs(int64(binary.LittleEndian.Uint64(b)))
+	for n := binary.LittleEndian.Uint64(b[8:]); g.n < n; {
+		g.NextID()
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package orderbook
+
+import "errors"
+
+var (
+	// ErrOffTick is returned for prices that are not a multiple of the tick size.
+	ErrOffTick = errors.New("price is not a multiple of the tick size")
+	// ErrOffLot is returned for sizes that are not a multiple of the lot size.
+	ErrOffLot = errors.New("size is not a multiple of the lot size")
+	// ErrPriceOutOfRange is returned for prices outside the instrument's price band.
+	ErrPriceOutOfRange = errors.New("price is outside the instrument's price band")
+	// ErrSizeOutOfRange is returned for sizes outside the instrument's order size limits.
+	ErrSizeOutOfRange = errors.New("size is outside the instrument's order size limits")
+)
+
+// Instrument holds the trading rules of the instrument a book trades.
+// Zero values impose no rule.
+type Instrument struct {
+	// PriceScale and SizeScale are the number of decimal places of the
+	// book's fixed-point prices and quantities.
+	PriceScale uint8
+	SizeScale  uint8
+
+	// TickSize is the price increment, every price must be a multiple of it.
+	TickSize Price
+	// LotSize is the size increment, every order size must be a multiple of it.
+	LotSize Quantity
+
+	MinSize  Quantity
+	MaxSize  Quantity
+	MinPrice Price
+	MaxPrice Price
+}
+
+// ParsePrice parses a decimal price at the instrument's price scale.
+func (i *Instrument) ParsePrice(s string) (Price, error) {
+	return ParsePrice(s, i.PriceScale)
+}
+
+// FormatPrice formats a price as a decimal at the instrument's price scale.
+func (i *Instrument) FormatPrice(p Price) string {
+	return p.Format(i.PriceScale)
+}
+
+// ParseQuantity parses a decimal quantity at the instrument's size scale.
+func (i *Instrument) ParseQuantity(s string) (Quantity, error) {
+	return ParseQuantity(s, i.SizeScale)
+}
+
+// FormatQuantity formats a quantity as a decimal at the instrument's size scale.
+func (i *Instrument) FormatQuantity(q Quantity) string {
+	return q.Format(i.SizeScale)
+}
+
+// tick returns the tick size of the instrument, the smallest price increment.
+func (i *Instrument) tick() Price {
+	if i.TickSize == 0 {
+		return 1
+	}
+	return i.TickSize
+}
+
+// checkPrice checks that price is on the tick grid and inside the price band.
+func (i *Instrument) checkPrice(price Price) error {
+	if i.TickSize != 0 && price%i.TickSize != 0 {
+		return ErrOffTick
+	}
+	if price < i.MinPrice || (i.MaxPrice != 0 && price > i.MaxPrice) {
+		return ErrPriceOutOfRange
+	}
+	return nil
+}
+
+// checkSize checks that size is a whole number of lots and inside the size limits.
+func (i *Instrument) checkSize(size Quantity) error {
+	if i.LotSize != 0 && size%i.LotSize != 0 {
+		return ErrOffLot
+	}
+	if size < i.MinSize || (i.MaxSize != 0 && size > i.MaxSize) {
+		return ErrSizeOutOfRange
+	}
+	return nil
+}
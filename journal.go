@@ -0,0 +1,320 @@
+package orderbook
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+// Journal is a write-ahead log of the commands applied to a book. Every
+// command is written to the journal before the book applies it, along with
+// the order id and time it was given, so that replaying the journal rebuilds
+// the book exactly, down to queue order.
+//
+// Each record is written with a single call to Write. If the underlying writer
+// has a Sync method, such as an *os.File, it is called after every record.
+// Once a write fails the journal refuses to record anything else, and the book
+// refuses the commands. A record that was written but failed to sync is in
+// the journal all the same, so the book applies its command, and the journal
+// refuses the ones after it.
+type Journal struct {
+	encoder
+	w   io.Writer
+	err error
+}
+
+// NewJournal returns a journal writing to w.
+func NewJournal(w io.Writer) *Journal {
+	return &Journal{w: w}
+}
+
+// Journal record kinds.
+const (
+	journalSubmit byte = iota + 1
+	journalAmend
+	journalCancel
+	journalCancelAll
+	journalExpire
+	journalStartAuction
+	journalUncross
+)
+
+// Records are framed as a 4 byte little-endian payload length, the payload
+// and a 4 byte CRC-32 of the payload. The payload is the record kind followed
+// by its fields as varints. Fields added to a record kind later are appended
+// to it, so older records decode with them as zero.
+
+func (j *Journal) submit(o Order, id OrderID, now, expires time.Time) error {
+	if j == nil {
+		return nil
+	}
+	var generated uint64
+	if o.ID == 0 {
+		generated = 1
+	}
+	j.begin(journalSubmit)
+	j.varint(int64(id))
+	j.uvarint(generated)
+	j.varint(unixNano(now))
+	j.uvarint(boolean(bool(o.Side)))
+	j.uvarint(uint64(o.Type))
+	j.uvarint(uint64(o.TimeInForce))
+	j.uvarint(uint64(o.PostOnly))
+	j.uvarint(uint64(o.Price))
+	j.uvarint(uint64(o.Size))
+	j.uvarint(uint64(o.Protection.MaxLevels))
+	j.uvarint(uint64(o.Protection.MaxSlippage))
+	j.bytes([]byte(o.Owner))
+	j.uvarint(uint64(o.DisplaySize))
+	j.uvarint(uint64(o.StopPrice))
+	j.uvarint(uint64(o.Trailing.Offset))
+	j.uvarint(uint64(o.Trailing.BasisPoints))
+	j.varint(unixNano(o.ExpireTime))
+	j.varint(unixNano(expires))
+	return j.commit()
+}
+
+func (j *Journal) amend(id OrderID, price Price, size Quantity, now time.Time) error {
+	if j == nil {
+		return nil
+	}
+	j.begin(journalAmend)
+	j.varint(int64(id))
+	j.varint(unixNano(now))
+	j.uvarint(uint64(price))
+	j.uvarint(uint64(size))
+	return j.commit()
+}
+
+func (j *Journal) cancel(id OrderID, now time.Time) error {
+	if j == nil {
+		return nil
+	}
+	j.begin(journalCancel)
+	j.varint(int64(id))
+	j.varint(unixNano(now))
+	return j.commit()
+}
+
+func (j *Journal) cancelAll(owner string, f CancelFilter, now time.Time) error {
+	if j == nil {
+		return nil
+	}
+	j.begin(journalCancelAll)
+	j.bytes([]byte(owner))
+	j.uvarint(boolean(f.OneSide))
+	j.uvarint(boolean(bool(f.Side)))
+	j.uvarint(uint64(f.MinPrice))
+	j.uvarint(uint64(f.MaxPrice))
+	j.varint(unixNano(now))
+	return j.commit()
+}
+
+func (j *Journal) expire(now time.Time) error {
+	if j == nil {
+		return nil
+	}
+	j.begin(journalExpire)
+	j.varint(unixNano(now))
+	return j.commit()
+}
+
+func (j *Journal) startAuction(reference Price, now time.Time) error {
+	if j == nil {
+		return nil
+	}
+	j.begin(journalStartAuction)
+	j.varint(unixNano(now))
+	j.uvarint(uint64(reference))
+	return j.commit()
+}
+
+func (j *Journal) uncross(now time.Time) error {
+	if j == nil {
+		return nil
+	}
+	j.begin(journalUncross)
+	j.varint(unixNano(now))
+	return j.commit()
+}
+
+func (j *Journal) begin(kind byte) {
+	j.buf = append(j.buf[:0], 0, 0, 0, 0, kind)
+}
+
+func (j *Journal) commit() error {
+	if j.err != nil {
+		return j.err
+	}
+	payload := j.buf[4:]
+	binary.LittleEndian.PutUint32(j.buf, uint32(len(payload)))
+	var sum [4]byte
+	binary.LittleEndian.PutUint32(sum[:], crc32.ChecksumIEEE(payload))
+	j.buf = append(j.buf, sum[:]...)
+
+	if _, j.err = j.w.Write(j.buf); j.err != nil {
+		return j.err
+	}
+	if s, ok := j.w.(interface{ Sync() error }); ok {
+		// Replay would apply the record, so the book must too.
+		j.err = s.Sync()
+	}
+	return nil
+}
+
+// Replay rebuilds a book from a journal. The book is created with cfg, and
+// if cfg has a journal, commands after the replay are recorded to it.
+func Replay(r io.Reader, cfg Config) (*Book, error) {
+	b := New(cfg)
+	return b, b.Replay(r)
+}
+
+// Replay applies the commands recorded in a journal to the book, without
+// recording them again. A record cut short at the end of the journal, as left
+// by a crash in the middle of a write, was never applied and is ignored.
+//
+// Order ids the book generated are drawn from its generator again as they are
+// replayed, so a deterministic generator carries on where it left off.
+func (b *Book) Replay(r io.Reader) error {
+	journal := b.journal
+	b.journal = nil
+	defer func() { b.journal = journal }()
+
+	var header, sum [4]byte
+	for {
+		if _, err := io.ReadFull(r, header[:]); err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		payload := make([]byte, binary.LittleEndian.Uint32(header[:]))
+		if _, err := io.ReadFull(r, payload); err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(r, sum[:]); err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if binary.LittleEndian.Uint32(sum[:]) != crc32.ChecksumIEEE(payload) {
+			return errors.New("journal record is corrupt")
+		}
+		if err := b.apply(&decoder{buf: payload}); err != nil {
+			return err
+		}
+	}
+}
+
+// apply applies a single journal record to the book.
+func (b *Book) apply(rec *decoder) error {
+	switch rec.byte() {
+	case journalSubmit:
+		id := OrderID(rec.varint())
+		generated := rec.uvarint() == 1
+		now := fromUnixNano(rec.varint())
+		o := Order{
+			Side:        Side(rec.uvarint() == 1),
+			Type:        OrderType(rec.uvarint()),
+			TimeInForce: TimeInForce(rec.uvarint()),
+			PostOnly:    PostOnly(rec.uvarint()),
+			Price:       Price(rec.uvarint()),
+			Size:        Quantity(rec.uvarint()),
+		}
+		o.Protection.MaxLevels = int(rec.uvarint())
+		o.Protection.MaxSlippage = uint(rec.uvarint())
+		o.Owner = string(rec.bytes())
+		o.DisplaySize = Quantity(rec.uvarint())
+		o.StopPrice = Price(rec.uvarint())
+		o.Trailing.Offset = Price(rec.uvarint())
+		o.Trailing.BasisPoints = uint(rec.uvarint())
+		o.ExpireTime = fromUnixNano(rec.varint())
+		// The expiry the book worked out, the time zone of a day order's
+		// session is not in the journal.
+		expires := fromUnixNano(rec.varint())
+		if rec.err != nil {
+			return rec.err
+		}
+		if expires.IsZero() {
+			expires = b.expiry(o, now)
+		}
+		if generated {
+			// Keep the generator in step with the journal.
+			b.newID(0)
+		} else {
+			o.ID = id
+		}
+		b.submit(o, id, now, expires)
+
+	case journalAmend:
+		id := OrderID(rec.varint())
+		now := fromUnixNano(rec.varint())
+		price, size := Price(rec.uvarint()), Quantity(rec.uvarint())
+		if rec.err != nil {
+			return rec.err
+		}
+		o, ok := b.orderMap[id]
+		if !ok {
+			return errors.New("journal amends an order that does not exist")
+		}
+		b.amend(o, price, size, now)
+
+	case journalCancel:
+		id := OrderID(rec.varint())
+		now := fromUnixNano(rec.varint())
+		if rec.err != nil {
+			return rec.err
+		}
+		o, ok := b.orderMap[id]
+		if !ok {
+			o, ok = b.stopMap[id]
+		}
+		if !ok {
+			return errors.New("journal cancels an order that does not exist")
+		}
+		b.withdraw(o, now)
+
+	case journalCancelAll:
+		owner := string(rec.bytes())
+		f := CancelFilter{
+			OneSide:  rec.uvarint() == 1,
+			Side:     Side(rec.uvarint() == 1),
+			MinPrice: Price(rec.uvarint()),
+			MaxPrice: Price(rec.uvarint()),
+		}
+		now := fromUnixNano(rec.varint())
+		if rec.err != nil {
+			return rec.err
+		}
+		b.cancelAll(owner, f, now)
+
+	case journalExpire:
+		now := fromUnixNano(rec.varint())
+		if rec.err != nil {
+			return rec.err
+		}
+		b.expire(now)
+
+	case journalStartAuction:
+		now := fromUnixNano(rec.varint())
+		reference := Price(rec.uvarint())
+		if rec.err != nil {
+			return rec.err
+		}
+		b.startAuction(reference, now)
+
+	case journalUncross:
+		now := fromUnixNano(rec.varint())
+		if rec.err != nil {
+			return rec.err
+		}
+		b.uncross(now)
+
+	default:
+		return errors.New("unknown journal record")
+	}
+	return nil
+}
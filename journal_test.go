@@ -0,0 +1,168 @@
+package orderbook
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// l3 returns both sides of the book order by order, with times
+// stripped of their monotonic clock readings so books compare equal.
+func l3(b *Book) [][]LevelOrders {
+	sides := [][]LevelOrders{b.DepthByOrder(Bid, 0), b.DepthByOrder(Ask, 0)}
+	for _, levels := range sides {
+		for _, l := range levels {
+			for i := range l.Orders {
+				l.Orders[i].Time = l.Orders[i].Time.Round(0)
+			}
+		}
+	}
+	return sides
+}
+
+func Test_Replay(t *testing.T) {
+	var buf bytes.Buffer
+	b := New(Config{Journal: NewJournal(&buf)})
+
+	b.Submit(Ask, 101, 5)
+	b.Submit(Ask, 101, 3)
+	b.Submit(Ask, 103, 2)
+	id, _, _ := b.Submit(Bid, 99, 4)
+	b.Submit(Bid, 98, 4)
+	b.SubmitOrder(Order{ID: 42, Side: Bid, Price: 100, Size: 1})
+	b.Submit(Bid, 101, 6)
+	b.Amend(id, 99, 2)
+	b.Amend(42, 99, 3)
+	b.Cancel(3)
+	b.SubmitOrder(Order{Side: Ask, Price: 105, Size: 1, Owner: "a"})
+	b.SubmitOrder(Order{Side: Ask, Price: 106, Size: 1, Owner: "a"})
+	b.SubmitOrder(Order{Side: Ask, Price: 107, Size: 5, DisplaySize: 1})
+	b.SubmitOrder(Order{Side: Bid, Type: StopLimit, StopPrice: 101, Price: 107, Size: 2})
+	b.SubmitOrder(Order{Side: Ask, Type: Stop, StopPrice: 95, Size: 1})
+	b.CancelAll("a", CancelFilter{MaxPrice: 105})
+	b.SubmitOrder(Order{Side: Bid, Price: 90, Size: 1, TimeInForce: GoodTillDate, ExpireTime: time.Now().Add(time.Hour)})
+	b.Expire()
+	b.StartAuction(0)
+	b.Submit(Ask, 89, 1)
+	b.Uncross()
+	before := l3(b)
+	b.SubmitOrder(Order{Side: Ask, Type: Market, Size: 2})
+	b.Cancel(1000) // Not journaled.
+
+	journal := buf.Bytes()
+	r, err := Replay(bytes.NewReader(journal), Config{})
+	assert.NoError(t, err)
+	assert.Equal(t, l3(b), l3(r))
+	assert.Equal(t, b.seq, r.seq)
+	assert.Equal(t, b.trades, r.trades)
+
+	// The generator carries on where the original left off.
+	next, _, _ := b.Submit(Bid, 90, 1)
+	replayed, _, _ := r.Submit(Bid, 90, 1)
+	assert.Equal(t, next, replayed)
+
+	// A torn last record is ignored, a corrupt one is not.
+	r, err = Replay(bytes.NewReader(journal[:len(journal)-3]), Config{})
+	assert.NoError(t, err)
+	assert.Equal(t, before, l3(r))
+
+	journal[len(journal)-5]++
+	_, err = Replay(bytes.NewReader(journal), Config{})
+	assert.Error(t, err)
+
+	// The zero time of a manual clock survives the journal.
+	var zero bytes.Buffer
+	z := testBook(Config{Journal: NewJournal(&zero)})
+	z.Submit(Bid, 100, 1)
+	z.Cancel(1)
+	z.Submit(Ask, 101, 1)
+	r, err = Replay(&zero, Config{})
+	assert.NoError(t, err)
+	assert.Equal(t, l3(z), l3(r))
+
+	// Day orders expire at the end of the session the book saw, whatever
+	// time zone the journal is replayed in.
+	var day bytes.Buffer
+	est := time.FixedZone("EST", -5*60*60)
+	d := New(Config{Journal: NewJournal(&day), Clock: NewManualClock(time.Date(2020, 1, 1, 20, 0, 0, 0, est))})
+	d.SubmitOrder(Order{Side: Bid, Price: 100, Size: 1, TimeInForce: Day})
+	r, err = Replay(&day, Config{})
+	assert.NoError(t, err)
+	assert.True(t, r.expiries[0].expires.Equal(time.Date(2020, 1, 2, 0, 0, 0, 0, est)))
+}
+
+func Test_Snapshot(t *testing.T) {
+	b := New(Config{IDs: NewRandomIDs(3)})
+	b.Submit(Ask, 101, 5)
+	b.Submit(Ask, 101, 3)
+	b.Submit(Ask, 104, 2)
+	b.SubmitOrder(Order{Side: Ask, Price: 104, Size: 9, DisplaySize: 2, Owner: "a"})
+	b.Submit(Bid, 99, 4)
+	b.Submit(Bid, 97, 1)
+	b.Submit(Bid, 102, 6)
+	b.SubmitOrder(Order{Side: Bid, Type: Stop, StopPrice: 110, Size: 3})
+	b.SubmitOrder(Order{Side: Ask, Type: Stop, Size: 1, Trailing: Trailing{Offset: 2}})
+	b.SubmitOrder(Order{Side: Bid, Price: 90, Size: 1, TimeInForce: Day})
+	postOnly, _, _ := b.SubmitOrder(Order{Side: Bid, Price: 95, Size: 1, PostOnly: PostOnlySlide})
+	b.StartAuction(100)
+
+	var snap bytes.Buffer
+	assert.NoError(t, b.Snapshot(&snap))
+	r, err := Restore(bytes.NewReader(snap.Bytes()), Config{})
+	assert.NoError(t, err)
+	assert.Equal(t, l3(b), l3(r))
+	assert.Equal(t, b.Depth(Ask, 0), r.Depth(Ask, 0))
+	assert.Equal(t, b.seq, r.seq)
+	assert.Equal(t, b.LastPrice(), r.LastPrice())
+	assert.Len(t, r.stopMap, 2)
+	assert.Len(t, r.expiries, 1)
+	assert.True(t, b.expiries[0].expires.Equal(r.expiries[0].expires))
+	assert.Equal(t, Auction, r.Phase())
+	assert.Equal(t, Price(100), r.reference)
+	assert.Equal(t, PostOnlySlide, r.orderMap[postOnly].postOnly)
+
+	// A journal started at the snapshot brings the restored book up to date.
+	var tail bytes.Buffer
+	b.journal = NewJournal(&tail)
+	b.Uncross()
+	b.Submit(Bid, 104, 3)
+	b.Cancel(b.bestBid.orders.first.id)
+	assert.NoError(t, r.Replay(&tail))
+	assert.Equal(t, l3(b), l3(r))
+	iceberg := r.OrdersByOwner("a")[0]
+	assert.Equal(t, Quantity(2), iceberg.Size)
+	assert.Equal(t, Quantity(7), iceberg.Hidden)
+	assert.Equal(t, Price(102), r.sellTrails.orders[0].price)
+
+	next, _, _ := b.Submit(Bid, 90, 1)
+	restored, _, _ := r.Submit(Bid, 90, 1)
+	assert.Equal(t, next, restored)
+
+	corrupt := snap.Bytes()
+	corrupt[10]++
+	_, err = Restore(bytes.NewReader(corrupt), Config{})
+	assert.Error(t, err)
+}
+
+// unsynced is a journal file whose every Sync fails.
+type unsynced struct{ bytes.Buffer }
+
+func (u *unsynced) Sync() error { return errors.New("sync failed") }
+
+func Test_JournalSync(t *testing.T) {
+	var file unsynced
+	b := testBook(Config{Journal: NewJournal(&file)})
+
+	// The first record made it to the file, the book applies it.
+	_, _, err := b.Submit(Bid, 100, 1)
+	assert.NoError(t, err)
+	_, _, err = b.Submit(Bid, 101, 1)
+	assert.Error(t, err)
+
+	r, err := Replay(&file, Config{})
+	assert.NoError(t, err)
+	assert.Equal(t, l3(b), l3(r))
+}
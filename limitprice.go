@@ -2,12 +2,31 @@ package orderbook
 
 // limitPrice is a single price limit.
 type limitPrice struct {
-	price    uint
+	price    Price
 	orders   orderList
 	parent   *limitPrice
 	children [2]*limitPrice
 	b        int8
 }
 
-func (l *limitPrice) higher() *limitPrice { return l.children[1] }
-func (l *limitPrice) lower() *limitPrice  { return l.children[0] }
+// higher returns the next limit above this one in the tree, or nil.
+func (l *limitPrice) higher() *limitPrice { return l.walk(1) }
+
+// lower returns the next limit below this one in the tree, or nil.
+func (l *limitPrice) lower() *limitPrice { return l.walk(0) }
+
+// walk returns the in-order neighbour of l in direction d,
+// where 1 is towards higher prices and 0 towards lower ones.
+func (l *limitPrice) walk(d int) *limitPrice {
+	if n := l.children[d]; n != nil {
+		for n.children[d^1] != nil {
+			n = n.children[d^1]
+		}
+		return n
+	}
+	n := l
+	for n.parent != nil && n == n.parent.children[d] {
+		n = n.parent
+	}
+	return n.parent
+}
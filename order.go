@@ -1,8 +1,6 @@
 package orderbook
 
-import (
-	"math/rand"
-)
+import "time"
 
 // OrderID is an order id.
 type OrderID int
@@ -16,17 +14,188 @@ const Bid Side = false
 // Ask means you are selling.
 const Ask Side = true
 
+// OrderType is the type of an order.
+type OrderType int
+
+const (
+	// Limit orders match up to their price and rest in the book until cancelled.
+	Limit OrderType = iota
+	// Market orders match at any price and never rest in the book,
+	// any quantity left unfilled is cancelled.
+	Market
+	// Stop orders wait outside the book until a trade at or through their
+	// stop price, then are submitted as market orders.
+	Stop
+	// StopLimit orders wait outside the book until a trade at or through
+	// their stop price, then are submitted as limit orders.
+	StopLimit
+)
+
+// TimeInForce is how long an order remains active in the book.
+type TimeInForce int
+
+const (
+	// GoodTillCancel orders rest in the book until filled or cancelled.
+	GoodTillCancel TimeInForce = iota
+	// ImmediateOrCancel orders fill what they can on arrival,
+	// the rest is cancelled.
+	ImmediateOrCancel
+	// FillOrKill orders fill their whole size on arrival or
+	// are cancelled without any executions.
+	FillOrKill
+	// GoodTillDate orders rest in the book until filled, cancelled
+	// or their expire time.
+	GoodTillDate
+	// Day orders rest in the book until filled, cancelled or the end
+	// of the trading session they were submitted in.
+	Day
+)
+
+// rests reports whether orders with the time in force may rest in the book.
+func (t TimeInForce) rests() bool {
+	return t == GoodTillCancel || t == GoodTillDate || t == Day
+}
+
+// PostOnly is what happens to a post-only order that would take liquidity on arrival.
+type PostOnly int
+
+const (
+	// Taker orders are not post-only, they match on arrival.
+	Taker PostOnly = iota
+	// PostOnlyReject orders that would match are rejected.
+	PostOnlyReject
+	// PostOnlySlide orders that would match are repriced one tick
+	// behind the opposite side's best price.
+	PostOnlySlide
+)
+
+// Order is an order submitted to the book.
+type Order struct {
+	// ID is an optional caller supplied order id. If zero, the book
+	// assigns one from its IDGenerator.
+	ID OrderID
+
+	Side        Side
+	Type        OrderType
+	TimeInForce TimeInForce
+	Price       Price
+	Size        Quantity
+
+	// ExpireTime is when a good till date order expires.
+	ExpireTime time.Time
+
+	// StopPrice is the trade price that triggers a stop order. Buy stops
+	// trigger on trades at or above it, sell stops at or below it.
+	StopPrice Price
+
+	// Trailing makes a stop order a trailing stop, which sets and moves
+	// its own stop price. StopPrice must then be zero.
+	Trailing Trailing
+
+	// PostOnly makes a limit order add liquidity only, never take it.
+	PostOnly PostOnly
+
+	// DisplaySize makes a limit order an iceberg order. Only up to this much
+	// of it is shown in the book at a time, the rest is held in reserve. When
+	// the shown clip is filled it is refilled from the reserve and goes to the
+	// back of the queue. Zero shows the whole order.
+	DisplaySize Quantity
+
+	// Owner identifies the participant or account the order belongs to.
+	// Orders with the same nonempty owner never trade with each other,
+	// see SelfTradePrevention.
+	Owner string
+
+	// Protection bounds how far a market order may sweep the book.
+	// It is ignored for limit orders.
+	Protection Protection
+}
+
+// Protection limits how much of the book a single market order can take.
+// Zero values mean no limit.
+type Protection struct {
+	// MaxLevels is the number of price levels the order may take liquidity from.
+	MaxLevels int
+	// MaxSlippage is the number of ticks the order may trade away from
+	// the best opposite price at the time it was submitted.
+	MaxSlippage uint
+}
+
+// OrderInfo is the state of an order resting in the book.
+type OrderInfo struct {
+	ID    OrderID
+	Side  Side
+	Price Price
+	Size  Quantity
+	// Hidden is the reserve of an iceberg order, on top of Size.
+	Hidden Quantity
+	Owner  string
+	// Time is when the order took its place in the queue.
+	Time time.Time
+	// Position is the order's place in the queue at its price,
+	// zero being the first in line.
+	Position int
+	// StopPrice is the stop price of a stop order waiting to be triggered,
+	// whose Price is the limit price it is submitted at, zero for a stop
+	// order, and whose Position is its place among the stops at its price.
+	StopPrice Price
+}
+
 // order is a single order in the book.
 type order struct {
 	id    OrderID
 	side  Side
-	price uint
-	size  uint
+	price Price
+	size  Quantity
+	time  time.Time
+	owner string
 	next  *order
 	prev  *order
+
+	// postOnly keeps a post-only order from taking liquidity when amended.
+	postOnly PostOnly
+
+	// display is the clip size of an iceberg order, hidden its reserve.
+	display Quantity
+	hidden  Quantity
+
+	// stop is the order a stop order submits when it is triggered.
+	// The stop order's price is its stop price.
+	stop *Order
+
+	// ref is the trade price a trailing stop follows,
+	// trail its index in the book's trailers heap.
+	ref   Price
+	trail int
+
+	// expires is when the order expires, if it does,
+	// expiry its index in the book's expiry queue.
+	expires time.Time
+	expiry  int
 }
 
-// genID returns a psuedo-random 8-digit order id.
-func genID() OrderID {
-	return OrderID(10000000 + rand.Intn(99999999-10000000))
+// info returns the state of o, which is at position in its queue.
+func (o *order) info(position int) OrderInfo {
+	if o.stop != nil {
+		return OrderInfo{
+			ID:        o.id,
+			Side:      o.side,
+			Price:     o.stop.Price,
+			Size:      o.size,
+			Owner:     o.owner,
+			Time:      o.time,
+			Position:  position,
+			StopPrice: o.price,
+		}
+	}
+	return OrderInfo{
+		ID:       o.id,
+		Side:     o.side,
+		Price:    o.price,
+		Size:     o.size,
+		Hidden:   o.hidden,
+		Owner:    o.owner,
+		Time:     o.time,
+		Position: position,
+	}
 }
@@ -2,9 +2,11 @@ package orderbook
 
 // orderList is a doubly-linked list of orders.
 type orderList struct {
-	first *order
-	last  *order
-	size  int
+	first  *order
+	last   *order
+	size   int
+	volume Quantity // total size of the orders in the list.
+	hidden Quantity // total reserve of the iceberg orders in the list.
 }
 
 // New instantiates a new list and adds the passed values, if any, to the list
@@ -19,7 +21,10 @@ func newOrderList(orders ...*order) orderList {
 // Add appends a value (one or more) at the end of the list.
 func (list *orderList) add(orders ...*order) {
 	for _, o := range orders {
-		//newElement := &element{value: value, prev: list.last}
+		o.prev = list.last
+		o.next = nil
+		list.volume += o.size
+		list.hidden += o.hidden
 		if list.size == 0 {
 			list.first = o
 			list.last = o
@@ -79,7 +84,11 @@ func (list *orderList) removeID(id OrderID) {
 		}
 		element = element.next
 	}
+	list.removeOrder(element)
+}
 
+// removeOrder removes an order that is in the list, in constant time.
+func (list *orderList) removeOrder(element *order) {
 	if element == list.first {
 		list.first = element.next
 	}
@@ -92,9 +101,11 @@ func (list *orderList) removeID(id OrderID) {
 	if element.next != nil {
 		element.next.prev = element.prev
 	}
+	element.next = nil
+	element.prev = nil
 
-	element = nil
-
+	list.volume -= element.size
+	list.hidden -= element.hidden
 	list.size--
 }
 
@@ -106,6 +117,8 @@ func (list *orderList) remove(index int) {
 	}
 
 	if list.size == 1 {
+		list.first.next = nil
+		list.first.prev = nil
 		list.Clear()
 		return
 	}
@@ -134,9 +147,11 @@ func (list *orderList) remove(index int) {
 	if element.next != nil {
 		element.next.prev = element.prev
 	}
+	element.next = nil
+	element.prev = nil
 
-	element = nil
-
+	list.volume -= element.size
+	list.hidden -= element.hidden
 	list.size--
 }
 
@@ -202,6 +217,8 @@ func (list *orderList) Size() int {
 // Clear removes all elements from the list.
 func (list *orderList) Clear() {
 	list.size = 0
+	list.volume = 0
+	list.hidden = 0
 	list.first = nil
 	list.last = nil
 }
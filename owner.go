@@ -0,0 +1,155 @@
+package orderbook
+
+import (
+	"sort"
+	"time"
+)
+
+// CancelFilter narrows down the orders CancelAll cancels.
+// The zero value matches every order.
+type CancelFilter struct {
+	// OneSide matches only orders on Side.
+	OneSide bool
+	Side    Side
+
+	// MinPrice and MaxPrice, when nonzero, match only orders priced at or
+	// within them, stop orders by their stop price.
+	MinPrice Price
+	MaxPrice Price
+}
+
+func (f CancelFilter) match(o *order) bool {
+	if f.OneSide && o.side != f.Side {
+		return false
+	}
+	if f.MinPrice != 0 && o.price < f.MinPrice {
+		return false
+	}
+	if f.MaxPrice != 0 && o.price > f.MaxPrice {
+		return false
+	}
+	return true
+}
+
+// OrdersByOwner returns the orders of an owner. Resting orders come first,
+// bids then asks, each best price first and in queue order within a price.
+// Stop orders follow, buys then sells, each in the order they trigger in.
+func (b *Book) OrdersByOwner(owner string) []OrderInfo {
+	owned, positions := b.owned(owner, CancelFilter{})
+	infos := make([]OrderInfo, len(owned))
+	for i, o := range owned {
+		infos[i] = o.info(positions[i])
+	}
+	return infos
+}
+
+// CancelAll cancels every order of an owner that matches the filter, resting
+// or waiting to be triggered, such as when the owner disconnects. It returns
+// a cancellation report for each of them, in the order of OrdersByOwner.
+func (b *Book) CancelAll(owner string, f CancelFilter) ([]Execution, error) {
+	now := b.now()
+	if err := b.journal.cancelAll(owner, f, now); err != nil {
+		return nil, &OrderError{Op: "cancel all", Err: err}
+	}
+	return b.cancelAll(owner, f, now), nil
+}
+
+func (b *Book) cancelAll(owner string, f CancelFilter, now time.Time) []Execution {
+	execs := []Execution{}
+	b.at = now
+	owned, _ := b.owned(owner, f)
+	for _, o := range owned {
+		execs = append(execs, Execution{
+			OrderID:           o.id,
+			Type:              Cancelled,
+			Side:              o.side,
+			CancelledQuantity: o.size + o.hidden,
+			Price:             o.price,
+		})
+		if o.stop != nil {
+			b.release(o)
+		} else {
+			b.cancel(o, b.limit(o))
+		}
+	}
+	return stamp(execs, now)
+}
+
+// owned returns the orders of an owner that match the filter, and
+// their queue positions, sorted the way the book would walk them so that
+// anything done to them happens in the same order every time.
+func (b *Book) owned(owner string, f CancelFilter) ([]*order, []int) {
+	owned := []*order{}
+	positions := []int{}
+	for _, o := range b.owners[owner] {
+		if !f.match(o) {
+			continue
+		}
+		position := 0
+		for p := o.prev; p != nil; p = p.prev {
+			position++
+		}
+		owned = append(owned, o)
+		positions = append(positions, position)
+	}
+	sort.Sort(byBook{owned, positions})
+	return owned, positions
+}
+
+// byBook sorts resting orders bids first, best price first, then in queue
+// order, followed by stop orders buys first, in trigger order.
+type byBook struct {
+	orders    []*order
+	positions []int
+}
+
+func (s byBook) Len() int { return len(s.orders) }
+
+func (s byBook) Swap(i, j int) {
+	s.orders[i], s.orders[j] = s.orders[j], s.orders[i]
+	s.positions[i], s.positions[j] = s.positions[j], s.positions[i]
+}
+
+func (s byBook) Less(i, j int) bool {
+	oi, oj := s.orders[i], s.orders[j]
+	if (oi.stop == nil) != (oj.stop == nil) {
+		return oi.stop == nil
+	}
+	if oi.side != oj.side {
+		return oi.side == Bid
+	}
+	if oi.price != oj.price {
+		if oi.stop != nil {
+			// Buy stops trigger lowest first, sell stops highest first.
+			return crosses(oi.side, oj.price, oi.price)
+		}
+		return crosses(!oi.side, oj.price, oi.price)
+	}
+	return s.positions[i] < s.positions[j]
+}
+
+// own adds a resting or stop order to its owner's index.
+// Orders without an owner are not indexed.
+func (b *Book) own(o *order) {
+	if o.owner == "" {
+		return
+	}
+	orders, ok := b.owners[o.owner]
+	if !ok {
+		orders = make(map[OrderID]*order)
+		b.owners[o.owner] = orders
+	}
+	orders[o.id] = o
+}
+
+// disown removes an order from its owner's index.
+func (b *Book) disown(o *order) {
+	orders, ok := b.owners[o.owner]
+	if !ok {
+		return
+	}
+	delete(orders, o.id)
+	if len(orders) == 0 {
+		delete(b.owners, o.owner)
+	}
+}
@@ -0,0 +1,173 @@
+package orderbook
+
+import (
+	"io"
+	"sync"
+)
+
+// SafeBook is a Book that is safe for concurrent use. Reads of market data
+// share a read lock and may run in parallel, commands take the write lock
+// and run one at a time.
+type SafeBook struct {
+	mu   sync.RWMutex
+	book *Book
+}
+
+// NewSafeBook wraps a book for concurrent use. The book must not be
+// used directly afterwards.
+func NewSafeBook(b *Book) *SafeBook {
+	return &SafeBook{book: b}
+}
+
+// Submit is Book.Submit.
+func (s *SafeBook) Submit(side Side, price Price, size Quantity) (OrderID, []Execution, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.book.Submit(side, price, size)
+}
+
+// SubmitOrder is Book.SubmitOrder.
+func (s *SafeBook) SubmitOrder(o Order) (OrderID, []Execution, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.book.SubmitOrder(o)
+}
+
+// Amend is Book.Amend.
+func (s *SafeBook) Amend(id OrderID, price Price, size Quantity) ([]Execution, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.book.Amend(id, price, size)
+}
+
+// Cancel is Book.Cancel.
+func (s *SafeBook) Cancel(id OrderID) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.book.Cancel(id)
+}
+
+// CancelAll is Book.CancelAll.
+func (s *SafeBook) CancelAll(owner string, f CancelFilter) ([]Execution, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.book.CancelAll(owner, f)
+}
+
+// Expire is Book.Expire.
+func (s *SafeBook) Expire() ([]Execution, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.book.Expire()
+}
+
+// StartAuction is Book.StartAuction.
+func (s *SafeBook) StartAuction(reference Price) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.book.StartAuction(reference)
+}
+
+// Uncross is Book.Uncross.
+func (s *SafeBook) Uncross() ([]Execution, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.book.Uncross()
+}
+
+// Subscribe is Book.Subscribe. Listeners run under the write lock, so they
+// must not call back into the book.
+func (s *SafeBook) Subscribe(l Listener) (unsubscribe func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.book.Subscribe(l)
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		u()
+	}
+}
+
+// Top is Book.Top.
+func (s *SafeBook) Top() (bid, ask Price) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.book.Top()
+}
+
+// LastPrice is Book.LastPrice.
+func (s *SafeBook) LastPrice() Price {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.book.LastPrice()
+}
+
+// Phase is Book.Phase.
+func (s *SafeBook) Phase() Phase {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.book.Phase()
+}
+
+// ClearingPrice is Book.ClearingPrice.
+func (s *SafeBook) ClearingPrice() (Price, Quantity) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.book.ClearingPrice()
+}
+
+// Depth is Book.Depth.
+func (s *SafeBook) Depth(side Side, n int) []Level {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.book.Depth(side, n)
+}
+
+// DepthTo is Book.DepthTo.
+func (s *SafeBook) DepthTo(side Side, price Price) []Level {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.book.DepthTo(side, price)
+}
+
+// DepthByOrder is Book.DepthByOrder.
+func (s *SafeBook) DepthByOrder(side Side, n int) []LevelOrders {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.book.DepthByOrder(side, n)
+}
+
+// Order is Book.Order.
+func (s *SafeBook) Order(id OrderID) (OrderInfo, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.book.Order(id)
+}
+
+// OrdersByOwner is Book.OrdersByOwner.
+func (s *SafeBook) OrdersByOwner(owner string) []OrderInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.book.OrdersByOwner(owner)
+}
+
+// Snapshot is Book.Snapshot.
+func (s *SafeBook) Snapshot(w io.Writer) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.book.Snapshot(w)
+}
+
+// View calls f with the book under the read lock. f must only read from it.
+func (s *SafeBook) View(f func(*Book)) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	f(s.book)
+}
+
+// Update calls f with the book under the write lock.
+func (s *SafeBook) Update(f func(*Book)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f(s.book)
+}
@@ -0,0 +1,68 @@
+package orderbook
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_SafeBook(t *testing.T) {
+	s := NewSafeBook(Init())
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			for i := 0; i < 2000; i++ {
+				switch r.Intn(6) {
+				case 0, 1:
+					s.Submit(Side(r.Intn(2) == 0), Price(90+r.Intn(20)), Quantity(1+r.Intn(10)))
+				case 2:
+					s.Cancel(OrderID(r.Intn(i*8 + 1)))
+				case 3:
+					s.Amend(OrderID(r.Intn(i*8+1)), Price(90+r.Intn(20)), Quantity(1+r.Intn(10)))
+				case 4:
+					s.Depth(Side(r.Intn(2) == 0), 5)
+				default:
+					bid, ask := s.Top()
+					if bid != 0 && ask != 0 {
+						assert.True(t, bid < ask)
+					}
+				}
+			}
+		}(int64(w))
+	}
+	wg.Wait()
+
+	s.View(func(b *Book) {
+		var size Quantity
+		for _, side := range []Side{Bid, Ask} {
+			for _, l := range b.Depth(side, 0) {
+				size += l.Size
+			}
+		}
+		var orders Quantity
+		for _, o := range b.orderMap {
+			orders += o.size
+		}
+		assert.Equal(t, orders, size)
+	})
+}
+
+func benchmarkBook(b *testing.B, submit func(Side, Price, Quantity) (OrderID, []Execution, error)) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < b.N; i++ {
+		submit(Side(r.Intn(2) == 0), Price(90+r.Intn(20)), Quantity(1+r.Intn(10)))
+	}
+}
+
+func Benchmark_Book(b *testing.B) {
+	benchmarkBook(b, Init().Submit)
+}
+
+func Benchmark_SafeBook(b *testing.B) {
+	benchmarkBook(b, NewSafeBook(Init()).Submit)
+}
@@ -0,0 +1,216 @@
+package orderbook
+
+import (
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+)
+
+// Snapshots start with a magic string and a format version, followed by the
+// book's state as varints and a CRC-32 of everything before it.
+const (
+	snapshotMagic   = "OBSNAP"
+	snapshotVersion = 1
+)
+
+// Kinds of id generator state in a snapshot.
+const (
+	generatorOther byte = iota
+	generatorSequence
+	generatorRandom
+)
+
+// Snapshot writes the state of the book to w in a compact binary format. It
+// holds every resting order in queue order, every stop order in trigger order,
+// the state of the id generator, if it implements encoding.BinaryMarshaler,
+// the last trade price, the trading phase and auction reference price and the
+// trade and event sequence numbers. Listeners and the journal are not part of it.
+//
+// To recover from a snapshot and a journal, take the snapshot between commands
+// and start a new journal for the commands that follow it. Restore the
+// snapshot, then Replay the new journal into the restored book.
+func (b *Book) Snapshot(w io.Writer) error {
+	e := &encoder{buf: []byte(snapshotMagic)}
+	e.uvarint(snapshotVersion)
+	e.uvarint(b.trades)
+	e.uvarint(b.seq)
+
+	kind := generatorOther
+	switch b.ids.(type) {
+	case *Sequence:
+		kind = generatorSequence
+	case *RandomIDs:
+		kind = generatorRandom
+	}
+	var state []byte
+	if m, ok := b.ids.(encoding.BinaryMarshaler); ok {
+		var err error
+		if state, err = m.MarshalBinary(); err != nil {
+			return err
+		}
+	}
+	e.byte(kind)
+	e.bytes(state)
+
+	for _, side := range []Side{Bid, Ask} {
+		tree := b.bidTree
+		if side == Ask {
+			tree = b.askTree
+		}
+		e.uvarint(uint64(tree.size))
+		for lim := b.best(side); lim != nil; lim = next(side, lim) {
+			e.uvarint(uint64(lim.price))
+			e.uvarint(uint64(lim.orders.Size()))
+			for o := lim.orders.first; o != nil; o = o.next {
+				e.varint(int64(o.id))
+				e.uvarint(uint64(o.size))
+				e.varint(unixNano(o.time))
+				e.bytes([]byte(o.owner))
+				e.uvarint(uint64(o.display))
+				e.uvarint(uint64(o.hidden))
+				e.varint(unixNano(o.expires))
+				e.uvarint(uint64(o.postOnly))
+			}
+		}
+	}
+
+	e.uvarint(uint64(b.last))
+	for _, s := range []*stops{b.buyStops, b.sellStops} {
+		e.uvarint(uint64(len(s.levels)))
+		for lim := s.first; lim != nil; lim = s.next(lim) {
+			e.uvarint(uint64(lim.price))
+			e.uvarint(uint64(lim.orders.Size()))
+			for o := lim.orders.first; o != nil; o = o.next {
+				e.varint(int64(o.id))
+				e.varint(unixNano(o.time))
+				e.bytes([]byte(o.owner))
+				e.uvarint(uint64(o.stop.Type))
+				e.uvarint(uint64(o.stop.TimeInForce))
+				e.uvarint(uint64(o.stop.Price))
+				e.uvarint(uint64(o.size))
+				e.uvarint(uint64(o.stop.Protection.MaxLevels))
+				e.uvarint(uint64(o.stop.Protection.MaxSlippage))
+				e.uvarint(uint64(o.stop.Trailing.Offset))
+				e.uvarint(uint64(o.stop.Trailing.BasisPoints))
+				e.uvarint(uint64(o.ref))
+				e.varint(unixNano(o.stop.ExpireTime))
+				e.varint(unixNano(o.expires))
+			}
+		}
+	}
+	e.uvarint(uint64(b.phase))
+	e.uvarint(uint64(b.reference))
+
+	var sum [4]byte
+	binary.LittleEndian.PutUint32(sum[:], crc32.ChecksumIEEE(e.buf))
+	e.buf = append(e.buf, sum[:]...)
+	_, err := w.Write(e.buf)
+	return err
+}
+
+// Restore reads a book written by Snapshot, creating it with cfg. If cfg has no
+// id generator, a Sequence or RandomIDs generator is restored from the
+// snapshot. A generator given in cfg gets the snapshot's generator state if it
+// implements encoding.BinaryUnmarshaler.
+func Restore(r io.Reader, cfg Config) (*Book, error) {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) < len(snapshotMagic)+4 || string(buf[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, errors.New("not an order book snapshot")
+	}
+	body := buf[:len(buf)-4]
+	if binary.LittleEndian.Uint32(buf[len(body):]) != crc32.ChecksumIEEE(body) {
+		return nil, errors.New("snapshot is corrupt")
+	}
+
+	d := &decoder{buf: body[len(snapshotMagic):]}
+	if d.uvarint() != snapshotVersion {
+		return nil, errors.New("unsupported snapshot version")
+	}
+	trades, seq := d.uvarint(), d.uvarint()
+
+	kind, state := d.byte(), d.bytes()
+	restoreIDs := cfg.IDs != nil || kind != generatorOther
+	if cfg.IDs == nil {
+		switch kind {
+		case generatorSequence:
+			cfg.IDs = &Sequence{}
+		case generatorRandom:
+			cfg.IDs = &RandomIDs{}
+		}
+	}
+	b := New(cfg)
+	if u, ok := b.ids.(encoding.BinaryUnmarshaler); ok && restoreIDs && len(state) > 0 {
+		if err := u.UnmarshalBinary(state); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, side := range []Side{Bid, Ask} {
+		for levels := d.uvarint(); levels > 0 && d.err == nil; levels-- {
+			price := Price(d.uvarint())
+			for orders := d.uvarint(); orders > 0 && d.err == nil; orders-- {
+				o := &order{
+					id:       OrderID(d.varint()),
+					side:     side,
+					price:    price,
+					size:     Quantity(d.uvarint()),
+					time:     fromUnixNano(d.varint()),
+					owner:    string(d.bytes()),
+					display:  Quantity(d.uvarint()),
+					hidden:   Quantity(d.uvarint()),
+					expires:  fromUnixNano(d.varint()),
+					postOnly: PostOnly(d.uvarint()),
+				}
+				b.rest(o)
+			}
+		}
+	}
+	b.last = Price(d.uvarint())
+	for _, side := range []Side{Bid, Ask} {
+		for levels := d.uvarint(); levels > 0 && d.err == nil; levels-- {
+			price := Price(d.uvarint())
+			for orders := d.uvarint(); orders > 0 && d.err == nil; orders-- {
+				o := &order{
+					id:    OrderID(d.varint()),
+					side:  side,
+					price: price,
+					time:  fromUnixNano(d.varint()),
+					owner: string(d.bytes()),
+				}
+				o.stop = &Order{
+					Side:        side,
+					Type:        OrderType(d.uvarint()),
+					TimeInForce: TimeInForce(d.uvarint()),
+					Price:       Price(d.uvarint()),
+					Size:        Quantity(d.uvarint()),
+					StopPrice:   price,
+					Owner:       o.owner,
+				}
+				o.stop.Protection.MaxLevels = int(d.uvarint())
+				o.stop.Protection.MaxSlippage = uint(d.uvarint())
+				o.stop.Trailing.Offset = Price(d.uvarint())
+				o.stop.Trailing.BasisPoints = uint(d.uvarint())
+				o.ref = Price(d.uvarint())
+				o.stop.ExpireTime = fromUnixNano(d.varint())
+				o.expires = fromUnixNano(d.varint())
+				o.size = o.stop.Size
+				b.hold(o)
+			}
+		}
+	}
+	b.phase = Phase(d.uvarint())
+	b.reference = Price(d.uvarint())
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	b.trades = trades
+	b.seq = seq
+	return b, nil
+}
@@ -0,0 +1,165 @@
+package orderbook
+
+import (
+	"container/heap"
+	"time"
+)
+
+// stops holds the stop orders on one side, waiting for the last trade price
+// to reach their stop price. They are kept in the order they trigger in: buy
+// stops lowest stop price first, sell stops highest stop price first, and in
+// time order at the same stop price.
+type stops struct {
+	side   Side
+	tree   *limitPriceTree
+	levels map[Price]*limitPrice
+	first  *limitPrice
+}
+
+func newStops(side Side) *stops {
+	return &stops{
+		side:   side,
+		tree:   &limitPriceTree{},
+		levels: make(map[Price]*limitPrice),
+	}
+}
+
+// add queues a stop order at its stop price.
+func (s *stops) add(o *order) {
+	lim, ok := s.levels[o.price]
+	if !ok {
+		lim = s.tree.addLimit(o.price)
+		s.levels[o.price] = lim
+		if s.first == nil || s.before(o.price, s.first.price) {
+			s.first = lim
+		}
+	}
+	lim.orders.add(o)
+}
+
+// remove takes a stop order out of the queue.
+func (s *stops) remove(o *order) {
+	lim := s.levels[o.price]
+	lim.orders.removeOrder(o)
+	if !lim.orders.Empty() {
+		return
+	}
+	if s.first == lim {
+		s.first = s.next(lim)
+	}
+	delete(s.levels, lim.price)
+	s.tree.removeLimit(lim.price)
+}
+
+// before reports whether stops at price a trigger before stops at price b.
+func (s *stops) before(a, b Price) bool {
+	if s.side == Bid {
+		return a < b
+	}
+	return a > b
+}
+
+// next returns the stop price that triggers after lim.
+func (s *stops) next(lim *limitPrice) *limitPrice {
+	if s.side == Bid {
+		return lim.higher()
+	}
+	return lim.lower()
+}
+
+// triggered returns the first stop order a trade at price triggers, if any.
+// Nothing triggers before the first trade.
+func (s *stops) triggered(price Price) *order {
+	if s.first == nil || price == 0 || s.before(price, s.first.price) {
+		return nil
+	}
+	return s.first.orders.first
+}
+
+// firing is a stop order triggered by a trade, waiting to be activated.
+type firing struct {
+	o     *order
+	price Price // of the trade that triggered it.
+}
+
+// fire takes the stop orders a trade at price triggers out of the trigger
+// book, to be activated once the command that made the trade is done matching.
+func (b *Book) fire(price Price) {
+	for _, s := range []*stops{b.buyStops, b.sellStops} {
+		for o := s.triggered(price); o != nil; o = s.triggered(price) {
+			b.release(o)
+			b.fired = append(b.fired, firing{o: o, price: price})
+		}
+	}
+}
+
+// hold puts a stop order in the trigger book.
+func (b *Book) hold(o *order) {
+	b.stopMap[o.id] = o
+	b.own(o)
+	b.schedule(o)
+	if o.side == Bid {
+		b.buyStops.add(o)
+	} else {
+		b.sellStops.add(o)
+	}
+	if o.stop.Trailing != (Trailing{}) {
+		heap.Push(b.trailers(o.side), o)
+	}
+}
+
+// release takes a stop order out of the trigger book.
+func (b *Book) release(o *order) {
+	delete(b.stopMap, o.id)
+	b.disown(o)
+	b.unschedule(o)
+	if o.side == Bid {
+		b.buyStops.remove(o)
+	} else {
+		b.sellStops.remove(o)
+	}
+	if o.stop.Trailing != (Trailing{}) {
+		heap.Remove(b.trailers(o.side), o.trail)
+	}
+}
+
+// trigger activates the stop orders the command's trades have reached, one at
+// a time, until there are none left. Every trade fires the stops at or beyond
+// its price, not just the last one, and stops fire in the order of the trades
+// that reached them, buy stops before sell stops at the same trade. Stops
+// submitted beyond the last trade price fire straight away. An activated stop
+// order is submitted as a market or limit order under its own id, and any
+// trades it makes may fire further stops, which are activated in turn as part
+// of the same command. Nothing is triggered during an auction.
+func (b *Book) trigger(now time.Time) []Execution {
+	var matches []Execution
+	if b.phase == Auction {
+		return matches
+	}
+	for {
+		if len(b.fired) == 0 {
+			b.fire(b.last)
+		}
+		if len(b.fired) == 0 {
+			return matches
+		}
+		f := b.fired[0]
+		b.fired = b.fired[1:]
+		o := f.o
+		matches = append(matches, Execution{OrderID: o.id,
+			Type:              Triggered,
+			Side:              o.side,
+			RemainingQuantity: o.size,
+			Price:             f.price})
+
+		activated := *o.stop
+		activated.StopPrice = 0
+		activated.Trailing = Trailing{}
+		if activated.Type == Stop {
+			activated.Type = Market
+		} else {
+			activated.Type = Limit
+		}
+		matches = append(matches, b.place(activated, o.id, now, o.expires)...)
+	}
+}
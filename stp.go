@@ -0,0 +1,94 @@
+package orderbook
+
+// SelfTradePrevention is what the book does when an incoming order would
+// trade with a resting order of the same owner. Orders without an owner
+// are never considered self trades.
+type SelfTradePrevention int
+
+const (
+	// AllowSelfTrade lets orders of the same owner trade with each other.
+	AllowSelfTrade SelfTradePrevention = iota
+	// CancelNewest cancels what is left of the incoming order.
+	CancelNewest
+	// CancelOldest cancels the resting order, the incoming order
+	// carries on matching.
+	CancelOldest
+	// CancelBoth cancels both orders.
+	CancelBoth
+	// DecrementAndCancel reduces both orders by the smaller of their sizes,
+	// cancelling the smaller one, or both if they are the same size. The
+	// incoming order carries on matching with whatever is left.
+	DecrementAndCancel
+)
+
+// preventsSelfTrade reports whether the book keeps t from trading
+// with orders of the same owner.
+func (b *Book) preventsSelfTrade(t *order) bool {
+	return b.stp != AllowSelfTrade && t.owner != ""
+}
+
+// selfTrade reports whether the incoming order t must not trade with the resting order m.
+func (b *Book) selfTrade(t, m *order) bool {
+	return b.preventsSelfTrade(t) && t.owner == m.owner
+}
+
+// preventSelfTrade applies the book's self trade prevention to the newer order
+// t and the older resting order m at lim, returning the reports. t is an
+// incoming order if tlim is nil, otherwise it rests at tlim.
+func (b *Book) preventSelfTrade(t *order, tlim *limitPrice, m *order, lim *limitPrice) []Execution {
+	var execs []Execution
+	tq, mq := t.size+t.hidden, m.size+m.hidden
+	switch b.stp {
+	case CancelNewest:
+		mq = 0
+	case CancelOldest:
+		tq = 0
+	case DecrementAndCancel:
+		if tq < mq {
+			mq = tq
+		} else {
+			tq = mq
+		}
+	}
+
+	if mq != 0 {
+		if mq == m.size+m.hidden {
+			b.unlink(m, lim)
+			m.size, m.hidden = 0, 0
+		} else {
+			b.reduce(m, lim, mq)
+		}
+		execs = append(execs, Execution{
+			OrderID:           m.id,
+			Type:              SelfTradePrevented,
+			Side:              m.side,
+			RemainingQuantity: m.size + m.hidden,
+			CancelledQuantity: mq,
+			HiddenQuantity:    m.hidden,
+			Price:             lim.price,
+			Counterparty:      t.id,
+		})
+	}
+	if tq != 0 {
+		switch {
+		case tlim == nil:
+			t.size -= tq
+		case tq == t.size+t.hidden:
+			b.unlink(t, tlim)
+			t.size, t.hidden = 0, 0
+		default:
+			b.reduce(t, tlim, tq)
+		}
+		execs = append(execs, Execution{
+			OrderID:           t.id,
+			Type:              SelfTradePrevented,
+			Side:              t.side,
+			RemainingQuantity: t.size + t.hidden,
+			CancelledQuantity: tq,
+			HiddenQuantity:    t.hidden,
+			Price:             lim.price,
+			Counterparty:      m.id,
+		})
+	}
+	return execs
+}
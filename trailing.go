@@ -0,0 +1,143 @@
+package orderbook
+
+import "container/heap"
+
+// Trailing makes a stop order a trailing stop. Its stop price is set at a
+// distance from the last trade price when it is submitted, and follows the
+// best trade price since: a sell stop moves up as the price trades higher, a
+// buy stop moves down as it trades lower. It never moves back. A trailing stop
+// limit order's limit price moves along with its stop price.
+//
+// The distance is either a fixed Offset or a number of BasisPoints of the
+// price it follows, rounded down to the tick size.
+type Trailing struct {
+	Offset      Price
+	BasisPoints uint
+}
+
+// trailers is a heap of the trailing stops on one side, the one the market
+// passes first on top: sell stops that follow the lowest trade price, and
+// buy stops that follow the highest.
+type trailers struct {
+	side   Side
+	orders []*order
+}
+
+func (h *trailers) Len() int { return len(h.orders) }
+
+func (h *trailers) Less(i, j int) bool {
+	oi, oj := h.orders[i], h.orders[j]
+	if oi.ref != oj.ref {
+		if h.side == Ask {
+			return oi.ref < oj.ref
+		}
+		return oi.ref > oj.ref
+	}
+	// Ties are broken by id so stops move in the same order however the heap
+	// was built, such as after a restore.
+	return oi.id < oj.id
+}
+
+func (h *trailers) Swap(i, j int) {
+	h.orders[i], h.orders[j] = h.orders[j], h.orders[i]
+	h.orders[i].trail = i
+	h.orders[j].trail = j
+}
+
+func (h *trailers) Push(x interface{}) {
+	o := x.(*order)
+	o.trail = len(h.orders)
+	h.orders = append(h.orders, o)
+}
+
+func (h *trailers) Pop() interface{} {
+	o := h.orders[len(h.orders)-1]
+	h.orders[len(h.orders)-1] = nil
+	h.orders = h.orders[:len(h.orders)-1]
+	return o
+}
+
+// passed reports whether a trade at price is better than the price the
+// trailing stop on top of the heap follows.
+func (h *trailers) passed(price Price) bool {
+	if len(h.orders) == 0 {
+		return false
+	}
+	if h.side == Ask {
+		return price > h.orders[0].ref
+	}
+	return price < h.orders[0].ref
+}
+
+// trailers returns the heap of trailing stops on a side.
+func (b *Book) trailers(side Side) *trailers {
+	if side == Bid {
+		return b.buyTrails
+	}
+	return b.sellTrails
+}
+
+// follow moves the trailing stops a trade at price has passed.
+func (b *Book) follow(price Price) {
+	for _, h := range []*trailers{b.buyTrails, b.sellTrails} {
+		for h.passed(price) {
+			o := h.orders[0]
+			o.ref = price
+			heap.Fix(h, 0)
+			if stop, ok := b.trailingStop(o); ok {
+				b.moveStop(o, stop)
+			}
+		}
+	}
+}
+
+// trailingStop returns the stop price of a trailing stop following the price
+// o.ref. It is false if a sell stop would be at or below zero.
+func (b *Book) trailingStop(o *order) (Price, bool) {
+	t := o.stop.Trailing
+	offset := t.Offset
+	if t.BasisPoints != 0 {
+		tick := b.instrument.tick()
+		offset = o.ref * Price(t.BasisPoints) / 10000 / tick * tick
+	}
+	if o.side == Bid {
+		return o.ref + offset, true
+	}
+	if offset >= o.ref {
+		return 0, false
+	}
+	return o.ref - offset, true
+}
+
+// moveStop moves a held stop order to a better stop price, to the back of the
+// queue there, taking its limit price along. A stop whose stop or limit price
+// would leave the instrument's price band stays where it is.
+func (b *Book) moveStop(o *order, stop Price) {
+	if (o.side == Bid && stop > o.price) || (o.side == Ask && stop < o.price) {
+		return
+	}
+	limit := o.stop.Price
+	if o.stop.Type == StopLimit {
+		if o.side == Bid {
+			if limit > o.price-stop {
+				limit -= o.price - stop
+			}
+		} else {
+			limit += stop - o.price
+		}
+		if b.instrument.checkPrice(limit) != nil {
+			return
+		}
+	}
+	if b.instrument.checkPrice(stop) != nil {
+		return
+	}
+	s := b.buyStops
+	if o.side == Ask {
+		s = b.sellStops
+	}
+	s.remove(o)
+	o.stop.Price = limit
+	o.price = stop
+	s.add(o)
+}
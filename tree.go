@@ -2,8 +2,8 @@ package orderbook
 
 import "fmt"
 
-// compare evals uints.
-func compare(a, b uint) int {
+// compare evals prices.
+func compare(a, b Price) int {
 	switch {
 	case a > b:
 		return 1
@@ -22,22 +22,22 @@ type limitPriceTree struct {
 
 // Put inserts node into the tree.
 // Key should adhere to the comparator's type assertion, otherwise method panics.
-func (t *limitPriceTree) addLimit(price uint, order *order) *limitPrice {
-	lim := &limitPrice{price: price, orders: newOrderList(order)}
+func (t *limitPriceTree) addLimit(price Price, orders ...*order) *limitPrice {
+	lim := &limitPrice{price: price, orders: newOrderList(orders...)}
 	t.put(lim, nil, &t.root)
 	return lim
 }
 
 // Remove remove the node from the tree by key.
 // Key should adhere to the comparator's type assertion, otherwise method panics.
-func (t *limitPriceTree) removeLimit(price uint) {
+func (t *limitPriceTree) removeLimit(price Price) {
 	t.remove(price, &t.root)
 }
 
 // getOrders searches the node in the tree by key and returns its value or nil if key is not found in tree.
 // Second return parameter is true if key was found, otherwise false.
 // Key should adhere to the comparator's type assertion, otherwise method panics.
-// func (t *limitPriceTree) getOrders(key uint) (value *orderList, found bool) {
+// func (t *limitPriceTree) getOrders(key Price) (value *orderList, found bool) {
 // 	n := t.root
 // 	for n != nil {
 // 		cmp := compare(key, n.price)
@@ -89,7 +89,7 @@ func (t *limitPriceTree) put(lim *limitPrice, p *limitPrice, qp **limitPrice) bo
 	return false
 }
 
-func (t *limitPriceTree) remove(key uint, qp **limitPrice) bool {
+func (t *limitPriceTree) remove(key Price, qp **limitPrice) bool {
 	q := *qp
 	if q == nil {
 		return false
@@ -105,7 +105,19 @@ func (t *limitPriceTree) remove(key uint, qp **limitPrice) bool {
 			*qp = q.children[0]
 			return true
 		}
-		fix := removeMin(&q.children[1], &q.price, &q.orders)
+		// Splice the in-order successor into q's position rather than
+		// copying its key, so pointers to limits held elsewhere stay valid.
+		var min *limitPrice
+		fix := removeMin(&q.children[1], &min)
+		min.children = q.children
+		min.parent = q.parent
+		min.b = q.b
+		for _, child := range min.children {
+			if child != nil {
+				child.parent = min
+			}
+		}
+		*qp = min
 		if fix {
 			return removeFix(-1, qp)
 		}
@@ -125,18 +137,18 @@ func (t *limitPriceTree) remove(key uint, qp **limitPrice) bool {
 	return false
 }
 
-func removeMin(qp **limitPrice, minKey *uint, minVal *orderList) bool {
+// removeMin detaches the lowest limit of the subtree and returns it in min.
+func removeMin(qp **limitPrice, min **limitPrice) bool {
 	q := *qp
 	if q.children[0] == nil {
-		*minKey = q.price
-		minVal = &q.orders
+		*min = q
 		if q.children[1] != nil {
 			q.children[1].parent = q.parent
 		}
 		*qp = q.children[1]
 		return true
 	}
-	fix := removeMin(&q.children[0], minKey, minVal)
+	fix := removeMin(&q.children[0], min)
 	if fix {
 		return removeFix(1, qp)
 	}
@@ -1,6 +1,8 @@
 package orderbook
 
 import (
+	"math/rand"
+	"sort"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -26,3 +28,44 @@ func Test_Add(t *testing.T) {
 
 	assert.True(t, cool)
 }
+
+func Test_Remove(t *testing.T) {
+	tree := limitPriceTree{}
+	limits := map[Price]*limitPrice{}
+	r := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 2000; i++ {
+		p := Price(r.Intn(300) + 1)
+		if lim, ok := limits[p]; ok && r.Intn(2) == 0 {
+			tree.removeLimit(p)
+			delete(limits, p)
+			lim.parent = nil
+			continue
+		}
+		if _, ok := limits[p]; !ok {
+			limits[p] = tree.addLimit(p, &order{})
+		}
+	}
+
+	var prices []Price
+	for p := range limits {
+		prices = append(prices, p)
+	}
+	sort.Slice(prices, func(i, j int) bool { return prices[i] < prices[j] })
+
+	assert.Equal(t, len(prices), tree.size)
+	lim := limits[prices[0]]
+	for _, p := range prices {
+		// Limits must keep their identity through rebalancing.
+		assert.True(t, lim == limits[p])
+		lim = lim.higher()
+	}
+	assert.Nil(t, lim)
+
+	lim = limits[prices[len(prices)-1]]
+	for i := len(prices) - 1; i >= 0; i-- {
+		assert.Equal(t, prices[i], lim.price)
+		lim = lim.lower()
+	}
+	assert.Nil(t, lim)
+}